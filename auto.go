@@ -0,0 +1,107 @@
+package chrb
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// autoStateKey records the version file the shell hook last activated, as
+// root:version, so HookEnv can tell when nothing needs to change.
+const autoStateKey = "CHRB_AUTO_VERSION"
+
+// autoRubyKey records the RUBY_ROOT the hook activated, so HookEnv can tell
+// whether the active ruby is still its own or one the user picked with use.
+const autoRubyKey = "CHRB_AUTO_RUBY"
+
+// HookEnv returns the ops that switch the shell to the ruby for the version
+// file governing config.Dir. It returns no ops when the resolution is the
+// same as last time. Entering a project switches from whatever ruby is
+// active, but otherwise only rubies the hook activated itself are reset,
+// whether on leaving the project or entering one whose ruby can't be found.
+// In the latter case the state is still recorded, so the error is reported
+// once rather than at every prompt.
+//
+// Entering a directory shouldn't be enough to run its code, so a project's
+// options, which can change PATH or RUBYOPT, are only applied once the user
+// trusts it with TrustProject. Until then only its ruby version is used.
+func HookEnv(config *Config) ([]EnvOp, error) {
+	hookConfig := *config
+	hookConfig.TrustedOptionsOnly = true
+	config = &hookConfig
+
+	project, err := config.Project()
+	if err != nil {
+		return nil, err
+	}
+
+	state := ""
+	if project != nil {
+		state = project.Root + string(os.PathListSeparator) + project.RubyVersion
+		// so trusting the project applies its options at the next prompt
+		if project.Options != nil {
+			state += string(os.PathListSeparator) + "trusted"
+		}
+	}
+	if previous := config.Env.Getenv(autoStateKey); state == previous {
+		return nil, nil
+	}
+
+	env := config.Env.Clone()
+	if autoRuby, ok := env.LookupEnv(autoRubyKey); ok && autoRuby == env.Getenv("RUBY_ROOT") {
+		env.ResetRubyEnv(config.Uid)
+	}
+	env.Unsetenv(autoRubyKey)
+	env.Unsetenv(autoStateKey)
+	if project == nil {
+		return env.Ops(config.Env), nil
+	}
+	env.Setenv(autoStateKey, state)
+
+	ruby, err := FindRuby(project.RubyVersion, config)
+	if err != nil {
+		return env.Ops(config.Env), err
+	}
+	rubyEnv, err := ruby.Env(config)
+	if err != nil {
+		return env.Ops(config.Env), err
+	}
+	if err := CreateProjectGemset(config); err != nil {
+		return env.Ops(config.Env), err
+	}
+	rubyEnv.Setenv(autoStateKey, state)
+	rubyEnv.Setenv(autoRubyKey, string(ruby.RubyDir))
+	return rubyEnv.Ops(config.Env), nil
+}
+
+// InitScript returns the hook that runs hook-env before every prompt in the
+// named shell.
+func InitScript(name, chrbPath string) (string, error) {
+	switch filepath.Base(name) {
+	case "bash":
+		return fmt.Sprintf(`_chrb_hook() {
+  local status=$?
+  eval "$(%s hook-env --shell bash)"
+  return $status
+}
+if [[ ";${PROMPT_COMMAND:-};" != *";_chrb_hook;"* ]]; then
+  PROMPT_COMMAND="_chrb_hook${PROMPT_COMMAND:+;$PROMPT_COMMAND}"
+fi
+`, posixQuote(chrbPath)), nil
+	case "zsh":
+		return fmt.Sprintf(`_chrb_hook() {
+  eval "$(%s hook-env --shell zsh)"
+}
+typeset -ag precmd_functions
+if (( ! ${precmd_functions[(I)_chrb_hook]} )); then
+  precmd_functions=(_chrb_hook $precmd_functions)
+fi
+`, posixQuote(chrbPath)), nil
+	case "fish":
+		return fmt.Sprintf(`function __chrb_hook --on-event fish_prompt
+    %s hook-env --shell fish | source
+end
+`, fishQuote(chrbPath)), nil
+	}
+	return "", fmt.Errorf("unsupported shell: %q", name)
+}
@@ -0,0 +1,215 @@
+package chrb_test
+
+import (
+	"testing"
+
+	"github.com/segiddins/chrb"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHookEnv(t *testing.T) {
+	config := &chrb.Config{
+		Fs:      afero.NewMemMapFs(),
+		Env:     chrb.ParseEnv([]string{"HOME=/Users/user", "PATH=/usr/bin"}),
+		Uid:     0,
+		Dir:     "/src/app/lib",
+		Options: chrb.DefaultOptions.Clone(),
+		RubyEnvFinder: func(r *chrb.Ruby) ([]string, error) {
+			return []string{
+				"RUBY_ENGINE=" + r.Engine,
+				"RUBY_VERSION=" + r.Version,
+			}, nil
+		},
+	}
+
+	for _, rubyDir := range []chrb.RubyDir{"/opt/rubies/ruby-3.3.6", "/opt/rubies/ruby-3.4.1"} {
+		assert.NoError(t, afero.WriteFile(config.Fs, rubyDir.ExecPath(), []byte("ruby"), 0755))
+	}
+	assert.NoError(t, config.Fs.MkdirAll(config.Dir, 0755))
+	assert.NoError(t, config.Fs.MkdirAll("/src/other", 0755))
+	assert.NoError(t, afero.WriteFile(config.Fs, "/src/app/.ruby-version", []byte("3.3.6\n"), 0644))
+	assert.NoError(t, afero.WriteFile(config.Fs, "/src/broken/.ruby-version", []byte("9.9\n"), 0644))
+
+	ops, err := chrb.HookEnv(config)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []chrb.EnvOp{
+		{Kind: chrb.EnvOpSet, Key: "CHRB_AUTO_RUBY", Value: "/opt/rubies/ruby-3.3.6"},
+		{Kind: chrb.EnvOpSet, Key: "CHRB_AUTO_VERSION", Value: "/src/app:3.3.6"},
+		{Kind: chrb.EnvOpPrepend, Key: "PATH", Value: "/opt/rubies/ruby-3.3.6/bin"},
+		{Kind: chrb.EnvOpSet, Key: "RUBY_ENGINE", Value: "ruby"},
+		{Kind: chrb.EnvOpSet, Key: "RUBY_ROOT", Value: "/opt/rubies/ruby-3.3.6"},
+		{Kind: chrb.EnvOpSet, Key: "RUBY_VERSION", Value: "3.3.6"},
+	}, ops)
+
+	// nothing changed, nothing to do
+	config.Env.Apply(ops)
+	ops, err = chrb.HookEnv(config)
+	assert.NoError(t, err)
+	assert.Empty(t, ops)
+
+	// leaving the project resets the ruby the hook activated
+	config.Dir = "/src/other"
+	ops, err = chrb.HookEnv(config)
+	assert.NoError(t, err)
+	config.Env.Apply(ops)
+	assert.Equal(t, "/usr/bin", config.Env.Getenv("PATH"))
+	_, ok := config.Env.LookupEnv("RUBY_ROOT")
+	assert.False(t, ok)
+	_, ok = config.Env.LookupEnv("CHRB_AUTO_VERSION")
+	assert.False(t, ok)
+	_, ok = config.Env.LookupEnv("CHRB_AUTO_RUBY")
+	assert.False(t, ok)
+
+	// a ruby that isn't installed is only reported once
+	config.Dir = "/src/broken"
+	ops, err = chrb.HookEnv(config)
+	assert.Error(t, err)
+	assert.Equal(t, []chrb.EnvOp{{Kind: chrb.EnvOpSet, Key: "CHRB_AUTO_VERSION", Value: "/src/broken:9.9"}}, ops)
+	config.Env.Apply(ops)
+	ops, err = chrb.HookEnv(config)
+	assert.NoError(t, err)
+	assert.Empty(t, ops)
+}
+
+func TestHookEnv_KeepsOtherRubies(t *testing.T) {
+	config := &chrb.Config{
+		Fs:      afero.NewMemMapFs(),
+		Env:     chrb.ParseEnv([]string{"HOME=/Users/user", "PATH=/usr/bin"}),
+		Uid:     0,
+		Dir:     "/src/app",
+		Options: chrb.DefaultOptions.Clone(),
+		RubyEnvFinder: func(r *chrb.Ruby) ([]string, error) {
+			return []string{
+				"RUBY_ENGINE=" + r.Engine,
+				"RUBY_VERSION=" + r.Version,
+			}, nil
+		},
+	}
+	for _, rubyDir := range []chrb.RubyDir{"/opt/rubies/ruby-3.3.6", "/opt/rubies/ruby-3.4.1"} {
+		assert.NoError(t, afero.WriteFile(config.Fs, rubyDir.ExecPath(), []byte("ruby"), 0755))
+	}
+	assert.NoError(t, config.Fs.MkdirAll("/src/other", 0755))
+	assert.NoError(t, afero.WriteFile(config.Fs, "/src/app/.ruby-version", []byte("3.3.6\n"), 0644))
+	assert.NoError(t, afero.WriteFile(config.Fs, "/src/broken/.ruby-version", []byte("9.9\n"), 0644))
+
+	hook := func() error {
+		ops, err := chrb.HookEnv(config)
+		config.Env.Apply(ops)
+		return err
+	}
+	use := func(pattern string) {
+		ruby, err := chrb.FindRuby(pattern, config)
+		assert.NoError(t, err)
+		env, err := ruby.Env(config)
+		assert.NoError(t, err)
+		config.Env.Apply(env.Ops(config.Env))
+	}
+
+	// a project whose ruby is missing resets the one the hook activated
+	assert.NoError(t, hook())
+	assert.Equal(t, "/opt/rubies/ruby-3.3.6", config.Env.Getenv("RUBY_ROOT"))
+	config.Dir = "/src/broken"
+	assert.Error(t, hook())
+	_, ok := config.Env.LookupEnv("RUBY_ROOT")
+	assert.False(t, ok)
+	assert.Equal(t, "/usr/bin", config.Env.Getenv("PATH"))
+
+	// but keeps one the user picked
+	use("3.4")
+	config.Dir = "/src/other"
+	assert.NoError(t, hook())
+	config.Dir = "/src/broken"
+	assert.Error(t, hook())
+	assert.Equal(t, "/opt/rubies/ruby-3.4.1", config.Env.Getenv("RUBY_ROOT"))
+
+	// as does leaving a project after switching rubies in it
+	config.Dir = "/src/app"
+	assert.NoError(t, hook())
+	assert.Equal(t, "/opt/rubies/ruby-3.3.6", config.Env.Getenv("RUBY_ROOT"))
+	use("3.4")
+	config.Dir = "/src/other"
+	assert.NoError(t, hook())
+	assert.Equal(t, "/opt/rubies/ruby-3.4.1", config.Env.Getenv("RUBY_ROOT"))
+	_, ok = config.Env.LookupEnv("CHRB_AUTO_VERSION")
+	assert.False(t, ok)
+}
+
+func TestHookEnv_Trust(t *testing.T) {
+	config := &chrb.Config{
+		Fs:      afero.NewMemMapFs(),
+		Env:     chrb.ParseEnv([]string{"HOME=/Users/user", "PATH=/usr/bin"}),
+		Uid:     0,
+		Dir:     "/src/app",
+		Options: chrb.DefaultOptions.Clone(),
+		RubyEnvFinder: func(r *chrb.Ruby) ([]string, error) {
+			return []string{"RUBY_ENGINE=" + r.Engine, "RUBY_VERSION=" + r.Version}, nil
+		},
+	}
+	rubyDir := chrb.RubyDir("/opt/rubies/ruby-3.3.6")
+	assert.NoError(t, afero.WriteFile(config.Fs, rubyDir.ExecPath(), []byte("ruby"), 0755))
+	assert.NoError(t, afero.WriteFile(config.Fs, "/src/app/.ruby-version", []byte("3.3.6\n"), 0644))
+	assert.NoError(t, afero.WriteFile(config.Fs, "/src/app/.chrb.json", []byte(`{"rubyopt": ["-r./evil"], "bundler": {"binstubs": ["bin"]}}`), 0644))
+	assert.NoError(t, afero.WriteFile(config.Fs, "/src/app/Gemfile", nil, 0644))
+
+	// only the ruby version is used until the project is trusted
+	ops, err := chrb.HookEnv(config)
+	assert.NoError(t, err)
+	config.Env.Apply(ops)
+	assert.Equal(t, "/opt/rubies/ruby-3.3.6", config.Env.Getenv("RUBY_ROOT"))
+	assert.Equal(t, "/opt/rubies/ruby-3.3.6/bin:/usr/bin", config.Env.Getenv("PATH"))
+	_, ok := config.Env.LookupEnv("RUBYOPT")
+	assert.False(t, ok)
+
+	// but commands run in the project still use its options
+	env, err := (&chrb.Ruby{Engine: "ruby", Version: "3.3.6", RubyDir: rubyDir}).Env(config)
+	assert.NoError(t, err)
+	assert.Equal(t, "-r./evil", env.Getenv("RUBYOPT"))
+
+	assert.NoError(t, chrb.TrustProject(config, "/src/app"))
+	ops, err = chrb.HookEnv(config)
+	assert.NoError(t, err)
+	config.Env.Apply(ops)
+	assert.Equal(t, "-r./evil", config.Env.Getenv("RUBYOPT"))
+	assert.Equal(t, "/src/app/bin:/opt/rubies/ruby-3.3.6/bin:/usr/bin", config.Env.Getenv("PATH"))
+
+	removed, err := chrb.UntrustProject(config, "/src/app")
+	assert.NoError(t, err)
+	assert.True(t, removed)
+	ops, err = chrb.HookEnv(config)
+	assert.NoError(t, err)
+	config.Env.Apply(ops)
+	_, ok = config.Env.LookupEnv("RUBYOPT")
+	assert.False(t, ok)
+	assert.Equal(t, "/opt/rubies/ruby-3.3.6/bin:/usr/bin", config.Env.Getenv("PATH"))
+}
+
+func TestHookEnv_CreatesGemset(t *testing.T) {
+	config := &chrb.Config{
+		Fs:      afero.NewMemMapFs(),
+		Env:     chrb.ParseEnv([]string{"HOME=/Users/user", "PATH=/usr/bin"}),
+		Uid:     501,
+		Dir:     "/src/app",
+		Options: chrb.DefaultOptions.Clone(),
+		RubyEnvFinder: func(r *chrb.Ruby) ([]string, error) {
+			return []string{"RUBY_ENGINE=" + r.Engine, "RUBY_VERSION=" + r.Version}, nil
+		},
+	}
+	rubyDir := chrb.RubyDir("/opt/rubies/ruby-3.3.6")
+	assert.NoError(t, afero.WriteFile(config.Fs, rubyDir.ExecPath(), []byte("ruby"), 0755))
+	assert.NoError(t, afero.WriteFile(config.Fs, "/src/app/.ruby-version", []byte("3.3.6\n"), 0644))
+	assert.NoError(t, afero.WriteFile(config.Fs, "/src/app/.chrb.json", []byte(`{"gemset": true}`), 0644))
+	assert.NoError(t, chrb.TrustProject(config, "/src/app"))
+
+	ops, err := chrb.HookEnv(config)
+	assert.NoError(t, err)
+	config.Env.Apply(ops)
+
+	gemsets, err := chrb.ListGemsets(config)
+	if assert.NoError(t, err) && assert.Len(t, gemsets, 1) {
+		assert.Equal(t, "/src/app", gemsets[0].Project)
+		assert.Equal(t, gemsets[0].Dir+"/ruby/3.3.6", config.Env.Getenv("GEM_HOME"))
+	}
+}
@@ -0,0 +1,323 @@
+package chrb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"os/signal"
+	"slices"
+	"syscall"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/jedib0t/go-pretty/v6/progress"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"github.com/urfave/cli/v3"
+)
+
+// BenchStats summarizes the wall times of the timed runs of a benchmark.
+// StdDev is the sample standard deviation, and 0 with a single run.
+type BenchStats struct {
+	Mean   time.Duration `json:"mean_ns"`
+	Median time.Duration `json:"median_ns"`
+	StdDev time.Duration `json:"stddev_ns"`
+	Min    time.Duration `json:"min_ns"`
+	Max    time.Duration `json:"max_ns"`
+}
+
+func NewBenchStats(times []time.Duration) BenchStats {
+	if len(times) == 0 {
+		return BenchStats{}
+	}
+	sorted := slices.Clone(times)
+	slices.Sort(sorted)
+
+	var sum float64
+	for _, t := range sorted {
+		sum += float64(t)
+	}
+	mean := sum / float64(len(sorted))
+	var squares float64
+	for _, t := range sorted {
+		squares += (float64(t) - mean) * (float64(t) - mean)
+	}
+	stddev := 0.0
+	if len(sorted) > 1 {
+		stddev = math.Sqrt(squares / float64(len(sorted)-1))
+	}
+
+	median := sorted[len(sorted)/2]
+	if len(sorted)%2 == 0 {
+		median = (sorted[len(sorted)/2-1] + sorted[len(sorted)/2]) / 2
+	}
+	return BenchStats{
+		Mean:   time.Duration(mean),
+		Median: median,
+		StdDev: time.Duration(stddev),
+		Min:    sorted[0],
+		Max:    sorted[len(sorted)-1],
+	}
+}
+
+// BenchResult is the benchmark of one ruby. Relative is its mean divided by
+// the baseline's, so above 1 is slower than the baseline, and is 0 when
+// either of them failed.
+type BenchResult struct {
+	Pattern  string          `json:"pattern"`
+	Engine   string          `json:"engine"`
+	Version  string          `json:"version"`
+	RubyDir  RubyDir         `json:"ruby_dir"`
+	Baseline bool            `json:"baseline"`
+	Times    []time.Duration `json:"times_ns"`
+	Stats    BenchStats      `json:"stats"`
+	Relative float64         `json:"relative,omitempty"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// BenchReport is everything written by bench --json, with the time it was
+// started at so reports can be compared over time.
+type BenchReport struct {
+	Command []string      `json:"command"`
+	Start   time.Time     `json:"start"`
+	Warmup  int           `json:"warmup"`
+	Runs    int           `json:"runs"`
+	Results []BenchResult `json:"results"`
+}
+
+// SetRelative compares the mean of every result with that of the baseline.
+func (r *BenchReport) SetRelative() {
+	i := slices.IndexFunc(r.Results, func(result BenchResult) bool { return result.Baseline })
+	if i < 0 || len(r.Results[i].Error) > 0 || r.Results[i].Stats.Mean == 0 {
+		return
+	}
+	baseline := r.Results[i].Stats.Mean
+	for i := range r.Results {
+		if len(r.Results[i].Error) > 0 {
+			continue
+		}
+		r.Results[i].Relative = float64(r.Results[i].Stats.Mean) / float64(baseline)
+	}
+}
+
+func (r *BenchReport) Write(config *Config, cmd *cli.Command, path string) error {
+	if path == "-" {
+		enc := json.NewEncoder(cmd.Writer)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	}
+
+	f, err := config.Fs.Create(path)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (r *BenchReport) table() string {
+	t := table.NewWriter()
+	t.AppendHeader(table.Row{"ruby", "version", "mean", "± stddev", "median", "min", "max", "relative"})
+	t.SetColumnConfigs([]table.ColumnConfig{
+		{Name: "mean", Align: text.AlignRight},
+		{Name: "± stddev", Align: text.AlignRight},
+		{Name: "median", Align: text.AlignRight},
+		{Name: "min", Align: text.AlignRight},
+		{Name: "max", Align: text.AlignRight},
+	})
+	round := func(d time.Duration) string {
+		return d.Round(time.Millisecond / 10).String()
+	}
+	for _, result := range r.Results {
+		version := result.Engine + " " + result.Version
+		if len(result.Error) > 0 {
+			t.AppendRow(table.Row{result.Pattern, version, "FAIL", "-", "-", "-", "-", "-"})
+			continue
+		}
+		relative := "-"
+		switch {
+		case result.Baseline:
+			relative = "baseline"
+		case result.Relative >= 1:
+			relative = fmt.Sprintf("%.2fx slower", result.Relative)
+		case result.Relative > 0:
+			relative = fmt.Sprintf("%.2fx faster", 1/result.Relative)
+		}
+		t.AppendRow(table.Row{
+			result.Pattern,
+			version,
+			round(result.Stats.Mean),
+			round(result.Stats.StdDev),
+			round(result.Stats.Median),
+			round(result.Stats.Min),
+			round(result.Stats.Max),
+			relative,
+		})
+	}
+	return t.Render()
+}
+
+// benchBaseline finds the entry to compare the others with, either labelled
+// with the pattern or for the same ruby it finds, defaulting to the first.
+func benchBaseline(config *Config, entries []matrixEntry, pattern string) (int, error) {
+	if len(pattern) == 0 {
+		return 0, nil
+	}
+	if i := slices.IndexFunc(entries, func(e matrixEntry) bool { return e.pattern == pattern }); i >= 0 {
+		return i, nil
+	}
+	ruby, err := FindRuby(pattern, config)
+	if err != nil {
+		return 0, err
+	}
+	if i := slices.IndexFunc(entries, func(e matrixEntry) bool { return e.ruby.RubyDir == ruby.RubyDir }); i >= 0 {
+		return i, nil
+	}
+	return 0, fmt.Errorf("baseline %q is not one of the benchmarked rubies", pattern)
+}
+
+func execBench(ctx context.Context, cmd *cli.Command) error {
+	runs := int(cmd.Int("runs"))
+	if runs < 1 {
+		return fmt.Errorf("invalid number of runs: %d", runs)
+	}
+	warmup := int(cmd.Int("warmup"))
+	if warmup < 0 {
+		return fmt.Errorf("invalid number of warmup runs: %d", warmup)
+	}
+	grace := cmd.Duration("grace-period")
+	timeout := cmd.Duration("timeout")
+	jsonPath := cmd.String("json")
+
+	config := GetConfig(ctx)
+
+	arg := commandArgs(ctx, cmd)
+	if len(arg) == 0 {
+		return fmt.Errorf("usage: chrb bench --ruby <ruby> -- <command>")
+	}
+
+	excludes := rejoinConstraints(cmd.StringSlice("exclude"))
+	entries, err := matrixEntries(config, nil, rejoinConstraints(cmd.StringSlice("ruby")), excludes, cmd.Bool("latest-per-minor"))
+	if err != nil {
+		return err
+	}
+	baseline, err := benchBaseline(config, entries, cmd.String("baseline"))
+	if err != nil {
+		return err
+	}
+
+	// progress goes to stderr when the report takes stdout
+	out := cmd.Writer
+	if jsonPath == "-" {
+		out = cmd.ErrWriter
+	}
+	fmt.Fprintf(out, "benchmarking %d rubies with %d warmup and %d timed runs:\n", len(entries), warmup, runs)
+	for _, entry := range entries {
+		fmt.Fprintf(out, "  %s (%s %s) %s\n", entry.pattern, entry.ruby.Engine, entry.ruby.Version, entry.ruby.RubyDir)
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	go func() {
+		select {
+		case <-signals:
+			fmt.Fprintln(out, "Interrupted")
+			cancel(errInterrupted)
+		case <-ctx.Done():
+		}
+	}()
+
+	pw := progress.NewWriter()
+	pw.SetAutoStop(true)
+	pw.SetOutputWriter(out)
+	pw.SetNumTrackersExpected(len(entries))
+	style := progress.StyleDefault
+	style.Visibility.TrackerOverall = false
+	style.Visibility.ETA = false
+	style.Visibility.ETAOverall = false
+	style.Options.TimeDonePrecision = time.Millisecond
+	pw.SetStyle(style)
+	trackers := []*progress.Tracker{}
+	for _, entry := range entries {
+		tracker := &progress.Tracker{
+			Message: fmt.Sprintf("%s (%s %s)", entry.pattern, entry.ruby.Engine, entry.ruby.Version),
+			Total:   int64(warmup + runs),
+		}
+		trackers = append(trackers, tracker)
+		pw.AppendTracker(tracker)
+	}
+	rendered := make(chan struct{})
+	go func() {
+		pw.Render()
+		close(rendered)
+	}()
+
+	report := &BenchReport{Command: arg, Start: time.Now(), Warmup: warmup, Runs: runs}
+	errs := []error{}
+	// one ruby at a time, so the runs don't compete for the machine
+	for i, entry := range entries {
+		tracker := trackers[i]
+		result := BenchResult{
+			Pattern:  entry.pattern,
+			Engine:   entry.ruby.Engine,
+			Version:  entry.ruby.Version,
+			RubyDir:  entry.ruby.RubyDir,
+			Baseline: i == baseline,
+			Times:    []time.Duration{},
+		}
+		for n := range warmup + runs {
+			if ctx.Err() != nil {
+				result.Error = context.Cause(ctx).Error()
+				break
+			}
+			attempt := runOnce(ctx, "", entry.env, arg, ResourceLimits{}, timeout, grace, nil, nil)
+			if attempt.err != nil {
+				result.Error = attempt.exit
+				if attempt.stopped {
+					result.Error = context.Cause(ctx).Error()
+				}
+				errs = append(errs, multierror.Prefix(fmt.Errorf("%s\n%s", result.Error, attempt.stdout), entry.pattern))
+				break
+			}
+			if n >= warmup {
+				result.Times = append(result.Times, attempt.time)
+			}
+			tracker.Increment(1)
+		}
+		result.Stats = NewBenchStats(result.Times)
+		if len(result.Error) > 0 {
+			tracker.MarkAsErrored()
+		} else {
+			tracker.MarkAsDone()
+		}
+		report.Results = append(report.Results, result)
+	}
+	<-rendered
+	report.SetRelative()
+
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, report.table())
+
+	if len(jsonPath) > 0 {
+		if err := report.Write(config, cmd, jsonPath); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return multierror.Append(nil, errs...)
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package chrb_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/segiddins/chrb"
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli/v3"
+)
+
+func TestNewBenchStats(t *testing.T) {
+	stats := chrb.NewBenchStats([]time.Duration{4 * time.Second, 2 * time.Second, 6 * time.Second, 4 * time.Second})
+	assert.Equal(t, chrb.BenchStats{
+		Mean:   4 * time.Second,
+		Median: 4 * time.Second,
+		StdDev: 1632993161,
+		Min:    2 * time.Second,
+		Max:    6 * time.Second,
+	}, stats)
+
+	stats = chrb.NewBenchStats([]time.Duration{3 * time.Second, time.Second, 2 * time.Second})
+	assert.Equal(t, 2*time.Second, stats.Median)
+	assert.Equal(t, time.Second, stats.StdDev)
+
+	stats = chrb.NewBenchStats([]time.Duration{time.Second})
+	assert.Equal(t, chrb.BenchStats{Mean: time.Second, Median: time.Second, Min: time.Second, Max: time.Second}, stats)
+
+	assert.Equal(t, chrb.BenchStats{}, chrb.NewBenchStats(nil))
+}
+
+func TestBenchReport_SetRelative(t *testing.T) {
+	report := chrb.BenchReport{
+		Results: []chrb.BenchResult{
+			{Pattern: "3.2", Stats: chrb.BenchStats{Mean: 3 * time.Second}},
+			{Pattern: "3.3", Baseline: true, Stats: chrb.BenchStats{Mean: 2 * time.Second}},
+			{Pattern: "3.4", Stats: chrb.BenchStats{Mean: time.Second}},
+			{Pattern: "head", Error: "exit status 1"},
+		},
+	}
+	report.SetRelative()
+	assert.Equal(t, 1.5, report.Results[0].Relative)
+	assert.Equal(t, 1.0, report.Results[1].Relative)
+	assert.Equal(t, 0.5, report.Results[2].Relative)
+	assert.Equal(t, 0.0, report.Results[3].Relative)
+
+	report.Results[1].Error = "exit status 1"
+	report.Results[0].Relative = 0
+	report.SetRelative()
+	assert.Equal(t, 0.0, report.Results[0].Relative)
+}
+
+func TestBench(t *testing.T) {
+	config, log := newRunConfig(t, "3.2.1", "3.3.6", "3.4.1")
+	t.Setenv("PATH", testPath)
+
+	out, err := runApp(config, "bench", "--ruby", "3.3", "--ruby", "3.4", "--runs", "2", "--warmup", "1", "--", "ruby", "-e", "--", "-w")
+	assert.NoError(t, err)
+	assert.Equal(t, strings.Repeat("ruby 3.3.6 -e -- -w\n", 3)+strings.Repeat("ruby 3.4.1 -e -- -w\n", 3), readLog(t, log))
+	assert.Contains(t, out, "benchmarking 2 rubies with 1 warmup and 2 timed runs:")
+	assert.Regexp(t, `\| 3\.3 +\| ruby 3\.3\.6 \|.*\| baseline +\|`, out)
+
+	_, err = runApp(config, "bench", "--ruby", "3.4", "--runs", "1", "--warmup", "0", "ruby", "--", "-v")
+	assert.NoError(t, err)
+	assert.Equal(t, "ruby 3.4.1 -v\n", readLog(t, log))
+
+	out, err = runApp(config, "bench", "--ruby", "3.4", "--runs", "3", "--", "sh", "-c", "exit 4")
+	assert.Error(t, err)
+	assert.Regexp(t, `\| 3\.4 +\| ruby 3\.4\.1 \| FAIL \|`, out)
+
+	_, err = runApp(config, "bench", "--ruby", "3.4")
+	assert.EqualError(t, err, "usage: chrb bench --ruby <ruby> -- <command>")
+}
+
+func TestBench_JSON(t *testing.T) {
+	config, _ := newRunConfig(t, "3.3.6", "3.4.1")
+	t.Setenv("PATH", testPath)
+
+	app := chrb.App(config)
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	app.Writer = stdout
+	app.ErrWriter = stderr
+	app.ExitErrHandler = func(context.Context, *cli.Command, error) {}
+	err := chrb.Run(context.Background(), app, []string{"chrb", "bench", "--ruby", "all", "--runs", "3", "--baseline", "ruby-3.4.1", "--json", "-", "--", "ruby", "-v"})
+	assert.NoError(t, err)
+	assert.Contains(t, stderr.String(), "benchmarking 2 rubies")
+
+	report := chrb.BenchReport{}
+	if !assert.NoError(t, json.Unmarshal(stdout.Bytes(), &report), stdout.String()) {
+		return
+	}
+	assert.Equal(t, []string{"ruby", "-v"}, report.Command)
+	assert.Equal(t, 3, report.Runs)
+	assert.Equal(t, 1, report.Warmup)
+	if assert.Len(t, report.Results, 2) {
+		assert.Equal(t, "3.3.6", report.Results[0].Version)
+		assert.False(t, report.Results[0].Baseline)
+		assert.Len(t, report.Results[0].Times, 3)
+		assert.Greater(t, report.Results[0].Relative, 0.0)
+		assert.True(t, report.Results[1].Baseline)
+		assert.Equal(t, 1.0, report.Results[1].Relative)
+		assert.Equal(t, chrb.NewBenchStats(report.Results[1].Times), report.Results[1].Stats)
+	}
+
+	path := filepath.Join(t.TempDir(), "bench.json")
+	_, err = runApp(config, "bench", "--ruby", "3.3", "--runs", "1", "--json", path, "--", "ruby", "-v")
+	assert.NoError(t, err)
+	content, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(content, &report))
+	assert.Len(t, report.Results, 1)
+}
+
+func TestBench_Baseline(t *testing.T) {
+	config, _ := newRunConfig(t, "3.2.1", "3.3.6", "3.4.1")
+	t.Setenv("PATH", testPath)
+
+	tests := []struct {
+		baseline string
+		want     string
+		error    string
+	}{
+		{baseline: "", want: "3.3"},
+		// the label of a benchmarked ruby
+		{baseline: "3.4", want: "3.4"},
+		// another way of finding one of them
+		{baseline: "ruby-3.4.1", want: "3.4"},
+		{baseline: "3.2", error: `baseline "3.2" is not one of the benchmarked rubies`},
+		{baseline: "2.7", error: "no ruby found for pattern: 2.7"},
+	}
+
+	for _, test := range tests {
+		name := test.baseline
+		if len(name) == 0 {
+			name = "the first"
+		}
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "bench.json")
+			_, err := runApp(config, "bench", "--ruby", "3.3", "--ruby", "3.4", "--runs", "1", "--warmup", "0", "--baseline", test.baseline, "--json", path, "--", "ruby", "-v")
+			if len(test.error) > 0 {
+				assert.ErrorContains(t, err, test.error)
+				return
+			}
+			assert.NoError(t, err)
+			content, err := os.ReadFile(path)
+			assert.NoError(t, err)
+			report := chrb.BenchReport{}
+			assert.NoError(t, json.Unmarshal(content, &report))
+			baselines := []string{}
+			for _, result := range report.Results {
+				if result.Baseline {
+					baselines = append(baselines, result.Pattern)
+				}
+			}
+			assert.Equal(t, []string{test.want}, baselines)
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package chrb
+
+import (
+	"path/filepath"
+
+	"github.com/spf13/afero"
+)
+
+// BundlerOptions configure activation for projects with a Gemfile. Paths are
+// relative to the project root.
+type BundlerOptions struct {
+	Gemfile  *bool    `json:"gemfile,omitempty"`
+	Path     string   `json:"path,omitempty"`
+	Binstubs []string `json:"binstubs,omitempty"`
+}
+
+func (o *BundlerOptions) Merge(other *BundlerOptions) {
+	if other.Gemfile != nil {
+		o.Gemfile = cloneBool(other.Gemfile)
+	}
+	if len(other.Path) > 0 {
+		o.Path = other.Path
+	}
+	if len(other.Binstubs) > 0 {
+		o.Binstubs = other.Binstubs
+	}
+}
+
+// GemfileEnabled reports whether BUNDLE_GEMFILE is set to the project's
+// Gemfile. Like Options.Gemset, it is unset by default so that a project can
+// turn it off as well as on.
+func (o *BundlerOptions) GemfileEnabled() bool {
+	return o.Gemfile != nil && *o.Gemfile
+}
+
+var gemfileNames = []string{"Gemfile", "gems.rb"}
+
+// Gemfile returns the path to the project's Gemfile, if it has one.
+func (p *Project) Gemfile(config *Config) (string, bool) {
+	for _, name := range gemfileNames {
+		path := filepath.Join(p.Root, name)
+		if exists, _ := afero.Exists(config.Fs, path); exists {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// bundlerEnvRule expresses the bundler options for project as an env rule,
+// so they are undone by ResetRubyEnv like any other rule.
+func bundlerEnvRule(config *Config, options *BundlerOptions, project *Project) (EnvRule, bool) {
+	if project == nil {
+		return EnvRule{}, false
+	}
+	gemfile, ok := project.Gemfile(config)
+	if !ok {
+		return EnvRule{}, false
+	}
+
+	rule := EnvRule{Set: map[string]string{}, Prepend: map[string]string{}}
+	if options.GemfileEnabled() {
+		rule.Set["BUNDLE_GEMFILE"] = gemfile
+	}
+	if len(options.Path) > 0 {
+		rule.Set["BUNDLE_PATH"] = filepath.Join(project.Root, options.Path)
+	}
+	// the first binstub directory ends up first in PATH
+	path := []string{}
+	for _, binstubs := range options.Binstubs {
+		path = append(path, filepath.Join(project.Root, binstubs))
+	}
+	if len(path) > 0 {
+		rule.Prepend["PATH"] = joinPathList(path...)
+	}
+
+	return rule, len(rule.Set) > 0 || len(rule.Prepend) > 0
+}
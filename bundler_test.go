@@ -0,0 +1,96 @@
+package chrb_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/segiddins/chrb"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBundler(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	rubyDir := chrb.RubyDir("/opt/rubies/ruby-3.3.6")
+	assert.NoError(t, afero.WriteFile(fs, rubyDir.ExecPath(), []byte("ruby"), 0755))
+	assert.NoError(t, fs.MkdirAll("/src/app/lib", 0755))
+	assert.NoError(t, afero.WriteFile(fs, "/src/app/.ruby-version", []byte("3.3.6"), 0644))
+	assert.NoError(t, afero.WriteFile(fs, "/src/app/.chrb.json", []byte(`{"bundler": {"path": "vendor/bundle", "binstubs": ["bin", ".bundle/bin"]}}`), 0644))
+	assert.NoError(t, fs.MkdirAll("/src/other", 0755))
+	assert.NoError(t, afero.WriteFile(fs, "/src/other/.ruby-version", []byte("3.3.6"), 0644))
+
+	enabled := true
+	options := chrb.DefaultOptions.Clone()
+	options.Bundler.Gemfile = &enabled
+	original := []string{"BUNDLE_PATH=/ignored", "HOME=/root", "PATH=/usr/bin"}
+	config := &chrb.Config{
+		Fs:      fs,
+		Env:     chrb.ParseEnv(original),
+		Uid:     0,
+		Dir:     "/src/app/lib",
+		Options: options,
+		RubyEnvFinder: func(r *chrb.Ruby) ([]string, error) {
+			return []string{"RUBY_ENGINE=" + r.Engine, "RUBY_VERSION=" + r.Version}, nil
+		},
+	}
+	ruby, err := chrb.RubyFromDir(config, rubyDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// without a Gemfile the bundler options don't apply
+	env, err := ruby.Env(config)
+	if assert.NoError(t, err) {
+		_, ok := env.LookupEnv("BUNDLE_GEMFILE")
+		assert.False(t, ok)
+		assert.Equal(t, "/ignored", env.Getenv("BUNDLE_PATH"))
+	}
+
+	assert.NoError(t, afero.WriteFile(fs, "/src/app/Gemfile", []byte("source 'https://rubygems.org'"), 0644))
+	env, err = ruby.Env(config)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "/src/app/Gemfile", env.Getenv("BUNDLE_GEMFILE"))
+	assert.Equal(t, "/src/app/vendor/bundle", env.Getenv("BUNDLE_PATH"))
+	assert.Equal(t, "/src/app/bin:/src/app/.bundle/bin:/opt/rubies/ruby-3.3.6/bin:/usr/bin", env.Getenv("PATH"))
+
+	// the project can turn off the user's BUNDLE_GEMFILE
+	assert.NoError(t, afero.WriteFile(fs, "/src/app/.chrb.json", []byte(`{"bundler": {"gemfile": false}}`), 0644))
+	gemfileOff, err := ruby.Env(config)
+	if assert.NoError(t, err) {
+		_, ok := gemfileOff.LookupEnv("BUNDLE_GEMFILE")
+		assert.False(t, ok)
+	}
+	assert.True(t, *options.Bundler.Gemfile)
+
+	// moving to a project without bundler options undoes them
+	config.Env = env
+	config.Dir = "/src/other"
+	env, err = ruby.Env(config)
+	if !assert.NoError(t, err) {
+		return
+	}
+	env.ResetRubyEnv(config.Uid)
+	envList := env.ToEnvList()
+	slices.Sort(envList)
+	assert.Equal(t, original, envList)
+}
+
+func TestBundlerOptions_Merge_Gemfile(t *testing.T) {
+	enabled, disabled := true, false
+
+	options := chrb.DefaultOptions.Clone()
+	assert.False(t, options.Bundler.GemfileEnabled())
+
+	options.Merge(&chrb.Options{Bundler: chrb.BundlerOptions{Gemfile: &enabled}})
+	assert.True(t, options.Bundler.GemfileEnabled())
+
+	// a project that doesn't mention the Gemfile keeps the user's choice
+	options.Merge(&chrb.Options{})
+	assert.True(t, options.Bundler.GemfileEnabled())
+
+	options.Merge(&chrb.Options{Bundler: chrb.BundlerOptions{Gemfile: &disabled}})
+	assert.False(t, options.Bundler.GemfileEnabled())
+	assert.True(t, enabled)
+}
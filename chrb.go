@@ -2,6 +2,7 @@ package chrb
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
@@ -22,16 +23,23 @@ type Ruby struct {
 }
 
 type Options struct {
-	KnownEngines         []string `json:"known_engines"`
-	DirectoryEnvPatterns []string `json:"directory_env_patterns"`
-	GemHomeEnvPattern    string   `json:"gem_home_env_pattern"`
+	KnownEngines         []string       `json:"known_engines"`
+	DirectoryEnvPatterns []string       `json:"directory_env_patterns"`
+	GemHomeEnvPattern    string         `json:"gem_home_env_pattern"`
+	GemsetsEnvPattern    string         `json:"gemsets_env_pattern"`
+	Gemset               *bool          `json:"gemset,omitempty"`
+	EnvRules             []EnvRule      `json:"env_rules"`
+	RubyOpt              []string       `json:"rubyopt"`
+	Bundler              BundlerOptions `json:"bundler"`
+	ShimsEnvPattern      string         `json:"shims_env_pattern"`
 }
 
 var DefaultOptions = Options{
 	KnownEngines:         []string{"ruby", "jruby", "mruby", "truffleruby-jvm", "truffleruby-native", "truffleruby"},
 	DirectoryEnvPatterns: []string{"$PREFIX/opt/rubies", "$HOME/.rubies"},
-	// TODO: allow using RUBY_API_VERSION instead of RUBY_VERSION
-	GemHomeEnvPattern: "$HOME/.gem/$RUBY_ENGINE/$RUBY_VERSION",
+	GemHomeEnvPattern:    "$HOME/.gem/$RUBY_ENGINE/$RUBY_VERSION",
+	GemsetsEnvPattern:    "$HOME/.gem/gemsets",
+	ShimsEnvPattern:      "$HOME/.chrb/shims",
 }
 
 func (o *Options) Clone() *Options {
@@ -39,6 +47,16 @@ func (o *Options) Clone() *Options {
 		KnownEngines:         slices.Clone(o.KnownEngines),
 		DirectoryEnvPatterns: slices.Clone(o.DirectoryEnvPatterns),
 		GemHomeEnvPattern:    strings.Clone(o.GemHomeEnvPattern),
+		GemsetsEnvPattern:    strings.Clone(o.GemsetsEnvPattern),
+		Gemset:               cloneBool(o.Gemset),
+		EnvRules:             slices.Clone(o.EnvRules),
+		RubyOpt:              slices.Clone(o.RubyOpt),
+		Bundler: BundlerOptions{
+			Gemfile:  cloneBool(o.Bundler.Gemfile),
+			Path:     o.Bundler.Path,
+			Binstubs: slices.Clone(o.Bundler.Binstubs),
+		},
+		ShimsEnvPattern: strings.Clone(o.ShimsEnvPattern),
 	}
 }
 
@@ -52,15 +70,69 @@ func (o *Options) Merge(other *Options) {
 	if len(other.GemHomeEnvPattern) > 0 {
 		o.GemHomeEnvPattern = other.GemHomeEnvPattern
 	}
+	if len(other.GemsetsEnvPattern) > 0 {
+		o.GemsetsEnvPattern = other.GemsetsEnvPattern
+	}
+	if other.Gemset != nil {
+		o.Gemset = cloneBool(other.Gemset)
+	}
+	// rules and RUBYOPT flags accumulate, so a project can add to the user's
+	// rather than replace them
+	o.EnvRules = append(o.EnvRules, other.EnvRules...)
+	o.RubyOpt = append(o.RubyOpt, other.RubyOpt...)
+	o.Bundler.Merge(&other.Bundler)
+	if len(other.ShimsEnvPattern) > 0 {
+		o.ShimsEnvPattern = other.ShimsEnvPattern
+	}
+}
+
+// GemsetEnabled reports whether projects get their own gemset. It is unset
+// by default, so that a project's options can turn it off as well as on.
+func (o *Options) GemsetEnabled() bool {
+	return o.Gemset != nil && *o.Gemset
+}
+
+func cloneBool(b *bool) *bool {
+	if b == nil {
+		return nil
+	}
+	clone := *b
+	return &clone
+}
+
+// UserOptionsPath returns the location of the user's options file,
+// following the XDG base directory spec.
+func UserOptionsPath(env *Env) string {
+	configHome := env.Getenv("XDG_CONFIG_HOME")
+	if len(configHome) == 0 {
+		configHome = filepath.Join(env.Getenv("HOME"), ".config")
+	}
+	return filepath.Join(configHome, "chrb", "config.json")
+}
+
+func ReadOptionsFile(fs afero.Fs, path string) (*Options, error) {
+	content, err := afero.ReadFile(fs, path)
+	if err != nil {
+		return nil, err
+	}
+	options := &Options{}
+	if err := json.Unmarshal(content, options); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", path, err)
+	}
+	return options, nil
 }
 
 type RubyEnvFinder func(r *Ruby) ([]string, error)
 type Config struct {
 	Options       *Options
 	Uid           int
+	Dir           string
 	Fs            afero.Fs
 	Env           *Env
 	RubyEnvFinder RubyEnvFinder
+	// TrustedOptionsOnly ignores the options of projects the user hasn't
+	// trusted, for the shell hook, which runs in every directory entered.
+	TrustedOptionsOnly bool
 }
 
 type RubyDir string
@@ -133,7 +205,7 @@ func ListRubies(config *Config) (rubies []Ruby, err error) {
 		if e != 0 {
 			return e
 		}
-		return strings.Compare(a.Version, b.Version)
+		return CompareVersions(a.Version, b.Version)
 	})
 	return rubies, nil
 }
@@ -193,6 +265,23 @@ func FindRuby(pattern string, config *Config) (Ruby, error) {
 	return Ruby{}, fmt.Errorf("no ruby found for pattern: %s", pattern)
 }
 
+// ResolveRuby finds the ruby selected by the project containing config.Dir,
+// falling back to defaultVersion when there is no project.
+func ResolveRuby(config *Config, defaultVersion string) (Ruby, error) {
+	project, err := config.Project()
+	if err != nil {
+		return Ruby{}, err
+	}
+	pattern := defaultVersion
+	if project != nil {
+		pattern = project.RubyVersion
+	}
+	if len(pattern) == 0 {
+		return Ruby{}, fmt.Errorf("no .ruby-version found in %s and no default ruby version set", config.Dir)
+	}
+	return FindRuby(pattern, config)
+}
+
 func ExecFindEnv(r *Ruby) ([]string, error) {
 	cmd := exec.Command(r.ExecPath(), "-rrubygems", "-e", `
 		puts "RUBY_ENGINE=#{Object.const_defined?(:RUBY_ENGINE) ? RUBY_ENGINE : 'ruby'}"
@@ -216,6 +305,8 @@ func ExecFindEnv(r *Ruby) ([]string, error) {
 
 func (r *Ruby) Env(config *Config) (*Env, error) {
 	env := config.Env.Clone()
+	env.ResetRubyEnv(config.Uid)
+
 	execPath := r.ExecPath()
 	stat, err := config.Fs.Stat(execPath)
 	if err != nil {
@@ -225,66 +316,79 @@ func (r *Ruby) Env(config *Config) (*Env, error) {
 		return nil, fmt.Errorf("ruby executable is not executable: %s %o", execPath, stat.Mode())
 	}
 
+	// GEM_PATH entries that were not set by a previous ruby are kept, as
+	// chruby does.
+	inheritedGemPath := env.Getenv("GEM_PATH")
+
 	foundEnv, err := config.RubyEnvFinder(r)
 	if err != nil {
 		return nil, fmt.Errorf("failed to find env for ruby at %s: %w", r.ExecPath(), err)
 	}
 	env = env.Merge(foundEnv)
 
-	path := env.Getenv("PATH")
-	if len(path) > 0 {
-		path = strings.Join([]string{string(r.RubyDir) + "/bin", path}, string(filepath.ListSeparator))
-	} else {
-		path = string(r.RubyDir) + "/bin"
+	project, err := config.Project()
+	if err != nil {
+		return nil, err
 	}
-
-	if os.Getuid() != 0 {
-		gemHome := env.ExpandEnv(DefaultOptions.GemHomeEnvPattern)
-		gemPath := gemHome
-		gemRoot := env.Getenv("GEM_ROOT")
-		if len(gemRoot) > 0 {
-			gemPath = strings.Join([]string{gemHome, gemRoot}, string(filepath.ListSeparator))
+	options := project.MergeOptions(config.Options)
+
+	// PATH is built in the same order as chruby_use:
+	// $GEM_HOME/bin:$GEM_ROOT/bin:$RUBY_ROOT/bin:$PATH
+	gemRoot := env.Getenv("GEM_ROOT")
+	path := joinPathList(binDir(gemRoot), filepath.Join(string(r.RubyDir), "bin"), env.Getenv("PATH"))
+
+	if config.Uid != 0 {
+		gemHome, _ := options.GemHome(env, project)
+		gemPath := joinPathList(gemHome, gemRoot, inheritedGemPath)
+
+		if project != nil && options.GemsetEnabled() {
+			gemset := ProjectGemset(env, options, project)
+			env.Setenv("CHRB_GEM_HOME", gemHome)
+			path = joinPathList(binDir(gemHome), path)
+			gemHome = gemset.GemHome(env)
+			gemPath = joinPathList(gemHome, gemPath)
 		}
+		path = joinPathList(binDir(gemHome), path)
+
 		env.GemHome = &gemHome
 		env.GemPath = &gemPath
-		env.GemRoot = &gemRoot
 	}
 
 	rubyRoot := string(r.RubyDir)
 	env.RubyRoot = &rubyRoot
 	env.Path = &path
 
+	rules := options.EnvRules
+	if rule, ok := bundlerEnvRule(config, &options.Bundler, project); ok {
+		rules = append(slices.Clone(rules), rule)
+	}
+	if err := env.applyEnvRules(rules, r); err != nil {
+		return nil, err
+	}
+	env.applyRubyOpt(options.RubyOpt)
+
 	return env, nil
 }
 
-func FindRubyVersion(config *Config, dir string) (string, error) {
-	dir, err := filepath.Abs(dir)
-	if err != nil {
-		return "", err
+func binDir(dir string) string {
+	if len(dir) == 0 {
+		return ""
 	}
-	for {
-		isDir, err := afero.DirExists(config.Fs, dir)
-		if err != nil {
-			return "", err
-		}
-		if !isDir {
-			return "", fmt.Errorf("%s is not a directory", dir)
-		}
+	return filepath.Join(dir, "bin")
+}
 
-		content, err := afero.ReadFile(config.Fs, filepath.Join(dir, ".ruby-version"))
-		if err != nil && !os.IsNotExist(err) {
-			return "", err
-		}
-		if err == nil {
-			return strings.TrimSpace(string(content)), nil
-		}
+// joinPathList joins the non-empty entries with the path list separator.
+func joinPathList(entries ...string) string {
+	entries = slices.DeleteFunc(entries, func(e string) bool {
+		return len(e) == 0
+	})
+	return strings.Join(entries, string(filepath.ListSeparator))
+}
 
-		parent := filepath.Dir(dir)
-		if parent == dir {
-			break
-		}
-		dir = parent
+func FindRubyVersion(config *Config, dir string) (string, error) {
+	project, err := FindProject(config, dir)
+	if err != nil {
+		return "", err
 	}
-
-	return "", fmt.Errorf("no ruby version file found")
+	return project.RubyVersion, nil
 }
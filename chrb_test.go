@@ -1,9 +1,13 @@
 package chrb_test
 
 import (
+	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"slices"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/segiddins/chrb"
@@ -81,7 +85,7 @@ func TestChrb(t *testing.T) {
 			"GEM_PATH=/Users/user/.gem/ruby/3.3.6:/gem/root",
 			"GEM_ROOT=/gem/root",
 			"HOME=/Users/user",
-			"PATH=/opt/rubies/ruby-3.3.6/bin",
+			"PATH=/Users/user/.gem/ruby/3.3.6/bin:/gem/root/bin:/opt/rubies/ruby-3.3.6/bin",
 			"RUBY_ENGINE=ruby",
 			"RUBY_ROOT=/opt/rubies/ruby-3.3.6",
 			"RUBY_VERSION=3.3.6",
@@ -111,3 +115,258 @@ func TestChrb(t *testing.T) {
 		assert.Error(t, err)
 	}
 }
+
+func TestRuby_Env(t *testing.T) {
+	finder := func(r *chrb.Ruby) ([]string, error) {
+		return []string{
+			"RUBY_ENGINE=" + r.Engine,
+			"RUBY_VERSION=" + r.Version,
+			"GEM_ROOT=" + string(r.RubyDir) + "/lib/gems",
+		}, nil
+	}
+
+	tests := []struct {
+		name    string
+		uid     int
+		dir     string
+		env     []string
+		options func(*chrb.Options)
+		want    []string
+	}{
+		{
+			name: "ruby as user",
+			uid:  501,
+			dir:  "/opt/rubies/ruby-3.3.6",
+			env:  []string{"HOME=/Users/user", "PATH=/usr/bin"},
+			want: []string{
+				"GEM_HOME=/Users/user/.gem/ruby/3.3.6",
+				"GEM_PATH=/Users/user/.gem/ruby/3.3.6:/opt/rubies/ruby-3.3.6/lib/gems",
+				"GEM_ROOT=/opt/rubies/ruby-3.3.6/lib/gems",
+				"HOME=/Users/user",
+				"PATH=/Users/user/.gem/ruby/3.3.6/bin:/opt/rubies/ruby-3.3.6/lib/gems/bin:/opt/rubies/ruby-3.3.6/bin:/usr/bin",
+				"RUBY_ENGINE=ruby",
+				"RUBY_ROOT=/opt/rubies/ruby-3.3.6",
+				"RUBY_VERSION=3.3.6",
+			},
+		},
+		{
+			name: "ruby as root",
+			uid:  0,
+			dir:  "/opt/rubies/ruby-3.3.6",
+			env:  []string{"HOME=/var/root", "PATH=/usr/bin"},
+			want: []string{
+				"GEM_ROOT=/opt/rubies/ruby-3.3.6/lib/gems",
+				"HOME=/var/root",
+				"PATH=/opt/rubies/ruby-3.3.6/lib/gems/bin:/opt/rubies/ruby-3.3.6/bin:/usr/bin",
+				"RUBY_ENGINE=ruby",
+				"RUBY_ROOT=/opt/rubies/ruby-3.3.6",
+				"RUBY_VERSION=3.3.6",
+			},
+		},
+		{
+			name: "jruby as user",
+			uid:  501,
+			dir:  "/opt/rubies/jruby-9.4.8.0",
+			env:  []string{"HOME=/Users/user"},
+			want: []string{
+				"GEM_HOME=/Users/user/.gem/jruby/9.4.8.0",
+				"GEM_PATH=/Users/user/.gem/jruby/9.4.8.0:/opt/rubies/jruby-9.4.8.0/lib/gems",
+				"GEM_ROOT=/opt/rubies/jruby-9.4.8.0/lib/gems",
+				"HOME=/Users/user",
+				"PATH=/Users/user/.gem/jruby/9.4.8.0/bin:/opt/rubies/jruby-9.4.8.0/lib/gems/bin:/opt/rubies/jruby-9.4.8.0/bin",
+				"RUBY_ENGINE=jruby",
+				"RUBY_ROOT=/opt/rubies/jruby-9.4.8.0",
+				"RUBY_VERSION=9.4.8.0",
+			},
+		},
+		{
+			name: "truffleruby as root",
+			uid:  0,
+			dir:  "/opt/rubies/truffleruby-24.0.0",
+			env:  []string{"HOME=/var/root"},
+			want: []string{
+				"GEM_ROOT=/opt/rubies/truffleruby-24.0.0/lib/gems",
+				"HOME=/var/root",
+				"PATH=/opt/rubies/truffleruby-24.0.0/lib/gems/bin:/opt/rubies/truffleruby-24.0.0/bin",
+				"RUBY_ENGINE=truffleruby",
+				"RUBY_ROOT=/opt/rubies/truffleruby-24.0.0",
+				"RUBY_VERSION=24.0.0",
+			},
+		},
+		{
+			name: "custom gem home pattern",
+			uid:  501,
+			dir:  "/opt/rubies/ruby-3.3.6",
+			env:  []string{"HOME=/Users/user"},
+			options: func(o *chrb.Options) {
+				o.GemHomeEnvPattern = "$HOME/gems/$RUBY_VERSION"
+			},
+			want: []string{
+				"GEM_HOME=/Users/user/gems/3.3.6",
+				"GEM_PATH=/Users/user/gems/3.3.6:/opt/rubies/ruby-3.3.6/lib/gems",
+				"GEM_ROOT=/opt/rubies/ruby-3.3.6/lib/gems",
+				"HOME=/Users/user",
+				"PATH=/Users/user/gems/3.3.6/bin:/opt/rubies/ruby-3.3.6/lib/gems/bin:/opt/rubies/ruby-3.3.6/bin",
+				"RUBY_ENGINE=ruby",
+				"RUBY_ROOT=/opt/rubies/ruby-3.3.6",
+				"RUBY_VERSION=3.3.6",
+			},
+		},
+		{
+			name: "switching from another ruby",
+			uid:  501,
+			dir:  "/opt/rubies/ruby-3.3.6",
+			env: []string{
+				"HOME=/Users/user",
+				"PATH=/Users/user/.gem/ruby/3.1.1/bin:/opt/rubies/ruby-3.1.1/lib/gems/bin:/opt/rubies/ruby-3.1.1/bin:/usr/local/bin:/usr/bin",
+				"RUBY_ROOT=/opt/rubies/ruby-3.1.1",
+				"RUBY_ENGINE=ruby",
+				"RUBY_VERSION=3.1.1",
+				"GEM_ROOT=/opt/rubies/ruby-3.1.1/lib/gems",
+				"GEM_HOME=/Users/user/.gem/ruby/3.1.1",
+				"GEM_PATH=/Users/user/.gem/ruby/3.1.1:/opt/rubies/ruby-3.1.1/lib/gems:/opt/gems",
+			},
+			want: []string{
+				"GEM_HOME=/Users/user/.gem/ruby/3.3.6",
+				"GEM_PATH=/Users/user/.gem/ruby/3.3.6:/opt/rubies/ruby-3.3.6/lib/gems:/opt/gems",
+				"GEM_ROOT=/opt/rubies/ruby-3.3.6/lib/gems",
+				"HOME=/Users/user",
+				"PATH=/Users/user/.gem/ruby/3.3.6/bin:/opt/rubies/ruby-3.3.6/lib/gems/bin:/opt/rubies/ruby-3.3.6/bin:/usr/local/bin:/usr/bin",
+				"RUBY_ENGINE=ruby",
+				"RUBY_ROOT=/opt/rubies/ruby-3.3.6",
+				"RUBY_VERSION=3.3.6",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			options := chrb.DefaultOptions.Clone()
+			if test.options != nil {
+				test.options(options)
+			}
+			config := &chrb.Config{
+				Fs:            afero.NewMemMapFs(),
+				Env:           chrb.ParseEnv(test.env),
+				Uid:           test.uid,
+				Options:       options,
+				RubyEnvFinder: finder,
+			}
+			rubyDir := chrb.RubyDir(test.dir)
+			err := afero.WriteFile(config.Fs, rubyDir.ExecPath(), []byte("ruby"), 0755)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ruby, err := chrb.RubyFromDir(config, rubyDir)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			env, err := ruby.Env(config)
+			if assert.NoError(t, err) {
+				envList := env.ToEnvList()
+				slices.Sort(envList)
+				assert.Equal(t, test.want, envList)
+			}
+		})
+	}
+}
+
+func TestRuby_Env_ChrubyParity(t *testing.T) {
+	bash := shells["bash"]
+	if len(bash) == 0 {
+		t.Skip("bash not found")
+	}
+	chrubySh, err := filepath.Abs("testdata/chruby.sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rubiesDir := t.TempDir()
+	newRuby := func(name, engine, version string) string {
+		dir := filepath.Join(rubiesDir, name)
+		script := fmt.Sprintf(`#!/bin/sh
+cat >/dev/null
+echo 'export RUBY_ENGINE=%s;'
+echo 'export RUBY_VERSION=%s;'
+echo 'export GEM_ROOT="%s/lib/ruby/gems";'
+`, engine, version, dir)
+		if err := os.MkdirAll(filepath.Join(dir, "bin"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "bin", "ruby"), []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+		return dir
+	}
+	ruby33 := newRuby("ruby-3.3.6", "ruby", "3.3.6")
+	jruby := newRuby("jruby-9.4.8.0", "jruby", "3.1.4")
+
+	tests := []struct {
+		name string
+		env  []string
+		from string
+		to   string
+	}{
+		{name: "fresh shell", env: []string{"HOME=/Users/user", "PATH=/usr/local/bin:/usr/bin"}, to: ruby33},
+		{name: "jruby", env: []string{"HOME=/Users/user", "PATH=/usr/bin"}, to: jruby},
+		{name: "inherited gem path", env: []string{"HOME=/Users/user", "PATH=/usr/bin", "GEM_PATH=/opt/gems"}, to: ruby33},
+		{name: "switching rubies", env: []string{"HOME=/Users/user", "PATH=/usr/bin:/bin", "GEM_PATH=/opt/gems"}, from: jruby, to: ruby33},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			script := "source " + strconv.Quote(chrubySh) + "\n"
+			if len(test.from) > 0 {
+				script += "chruby_use " + strconv.Quote(test.from) + "\n"
+			}
+			script += "chruby_use " + strconv.Quote(test.to) + "\nenv\n"
+			cmd := exec.Command(bash, "--noprofile", "--norc", "-c", script)
+			cmd.Env = test.env
+			out, err := cmd.Output()
+			if err != nil {
+				t.Fatal(err)
+			}
+			chruby := chrb.ParseEnv(strings.Split(string(out), "\n"))
+
+			config := &chrb.Config{
+				Fs:      afero.NewOsFs(),
+				Env:     chrb.ParseEnv(test.env),
+				Uid:     os.Getuid(),
+				Options: chrb.DefaultOptions.Clone(),
+				RubyEnvFinder: func(r *chrb.Ruby) ([]string, error) {
+					return []string{
+						"RUBY_ENGINE=" + filepath.Base(string(r.RubyDir))[:strings.Index(filepath.Base(string(r.RubyDir)), "-")],
+						"RUBY_VERSION=" + map[string]string{ruby33: "3.3.6", jruby: "3.1.4"}[string(r.RubyDir)],
+						"GEM_ROOT=" + string(r.RubyDir) + "/lib/ruby/gems",
+					}, nil
+				},
+			}
+			if len(test.from) > 0 {
+				from, err := chrb.RubyFromDir(config, chrb.RubyDir(test.from))
+				if err != nil {
+					t.Fatal(err)
+				}
+				config.Env, err = from.Env(config)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			to, err := chrb.RubyFromDir(config, chrb.RubyDir(test.to))
+			if err != nil {
+				t.Fatal(err)
+			}
+			env, err := to.Env(config)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			for _, key := range []string{"PATH", "GEM_HOME", "GEM_PATH", "GEM_ROOT", "RUBY_ROOT", "RUBY_ENGINE", "RUBY_VERSION"} {
+				want, wantOk := chruby.LookupEnv(key)
+				got, gotOk := env.LookupEnv(key)
+				assert.Equal(t, wantOk, gotOk, key)
+				assert.Equal(t, want, got, key)
+			}
+		})
+	}
+}
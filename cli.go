@@ -1,32 +1,67 @@
 package chrb
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
-	"os/exec"
-	"os/signal"
 	"path/filepath"
-	"sort"
-	"strconv"
+	"runtime"
+	"slices"
 	"strings"
 	"syscall"
 	"time"
 
-	"github.com/hashicorp/go-multierror"
-	"github.com/jedib0t/go-pretty/v6/progress"
+	"github.com/spf13/afero"
 	"github.com/urfave/cli/v3"
-	"golang.org/x/term"
 )
 
-var configKey = &struct{}{}
+// contextKey tells apart the values App keeps in the context. Pointers to
+// empty structs would not do, since they may all be equal.
+type contextKey int
+
+const (
+	configKey contextKey = iota
+	dashArgsKey
+)
 
 func GetConfig(ctx context.Context) *Config {
 	return ctx.Value(configKey).(*Config)
 }
 
+// Run runs app with args, keeping everything after the first -- away from
+// the flag parser. Once a flag comes before the --, it would otherwise carry
+// on parsing the command's own flags, as in exec --ruby 3.4 -- ruby -v, as
+// chrb's.
+func Run(ctx context.Context, app *cli.Command, args []string) error {
+	if i := slices.Index(args, "--"); i >= 0 {
+		ctx = context.WithValue(ctx, dashArgsKey, slices.Clone(args[i+1:]))
+		args = args[:i]
+	}
+	return app.Run(ctx, args)
+}
+
+// withDashArgs appends the arguments Run split off to args, after the --
+// they followed.
+func withDashArgs(ctx context.Context, args []string) []string {
+	if dashArgs, ok := ctx.Value(dashArgsKey).([]string); ok {
+		return slices.Concat(args, []string{"--"}, dashArgs)
+	}
+	return args
+}
+
+// commandArgs is the command given to matrix or bench, before or after the
+// --.
+func commandArgs(ctx context.Context, cmd *cli.Command) []string {
+	args := slices.Concat(*cmd.Arguments[0].(*cli.StringArg).Values, *cmd.Arguments[1].(*cli.StringArg).Values)
+	args = withDashArgs(ctx, args)
+	if i := slices.Index(args, "--"); i >= 0 {
+		args = slices.Delete(args, i, i+1)
+	}
+	return args
+}
+
 func App(config *Config) *cli.Command {
 	return &cli.Command{
 		Name:           "chrb",
@@ -43,6 +78,7 @@ func App(config *Config) *cli.Command {
 		},
 		Before: func(ctx context.Context, cmd *cli.Command) (context.Context, error) {
 			ctx = context.WithValue(ctx, configKey, config)
+			inheritWriters(cmd)
 			return ctx, nil
 		},
 		Commands: []*cli.Command{
@@ -82,21 +118,238 @@ func App(config *Config) *cli.Command {
 				Name:      "use",
 				Usage:     "prints the shell commands to eval to use the ruby",
 				ArgsUsage: "<ruby>",
-				Action:    useRuby,
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "shell",
+						Usage: "sh|bash|zsh|fish, defaults to $SHELL",
+					},
+				},
+				Action: useRuby,
+			},
+			{
+				Name:  "current",
+				Usage: "show the active ruby and where its gems are installed",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "format",
+						Value: "text",
+						Usage: "text|json",
+					},
+				},
+				Action: currentRuby,
+			},
+			{
+				Name:  "gemset",
+				Usage: "manage per-project gemsets",
+				Commands: []*cli.Command{
+					{
+						Name:  "list",
+						Usage: "list all gemsets",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "format",
+								Value: "text",
+								Usage: "text|json",
+							},
+						},
+						Action: listGemsets,
+					},
+					{
+						Name:      "rm",
+						Usage:     "remove the gemset for a project, defaulting to the current one",
+						ArgsUsage: "[project dir|gemset name]",
+						Action:    removeGemset,
+					},
+				},
+			},
+			{
+				Name:      "trust",
+				Usage:     "let the shell hook apply a project's .chrb.json, defaulting to the current project",
+				ArgsUsage: "[project dir]",
+				Action:    trustProject,
+				Commands: []*cli.Command{
+					{
+						Name:   "list",
+						Usage:  "list the trusted projects",
+						Action: listTrustedProjects,
+					},
+					{
+						Name:      "rm",
+						Usage:     "stop the shell hook applying a project's .chrb.json, defaulting to the current project",
+						ArgsUsage: "[project dir]",
+						Action:    untrustProject,
+					},
+				},
 			},
 			{
 				Name:      "exec",
-				Usage:     "execute a command with a ruby",
-				ArgsUsage: "<ruby> <command>",
-				Action:    execRuby,
+				Usage:     "execute a command with a ruby, defaulting to the one for the current directory",
+				ArgsUsage: "[ruby] -- <command>",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "ruby",
+						Usage: "the ruby to run the command with, overriding .ruby-version",
+					},
+					&cli.BoolFlag{
+						Name:  "bundle",
+						Usage: "run the command through bundle exec",
+					},
+					&cli.BoolFlag{
+						Name:  "no-exec",
+						Usage: "run the command as a child process and exit with its status, instead of replacing chrb",
+					},
+				},
+				Action: execRuby,
+			},
+			{
+				Name:      "init",
+				Usage:     "prints a hook to eval in your shell's startup file that switches rubies on directory change",
+				ArgsUsage: "<bash|zsh|fish>",
+				Action:    initShell,
+			},
+			{
+				Name:   "hook-env",
+				Usage:  "prints the shell commands to switch to the ruby for the current directory, if it changed",
+				Hidden: true,
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "shell",
+						Usage: "sh|bash|zsh|fish, defaults to $SHELL",
+					},
+				},
+				Action: hookEnv,
+			},
+			{
+				Name:   "shims",
+				Usage:  "generate executables that run ruby commands with the ruby for the current directory",
+				Action: writeShims,
+				Commands: []*cli.Command{
+					{
+						Name:   "rehash",
+						Usage:  "refresh the shims after installing gems or rubies",
+						Action: writeShims,
+					},
+				},
 			},
 			{
 				Name:  "matrix",
-				Usage: "run a command in a matrix of rubies",
+				Usage: "run a command in a matrix of rubies, defaulting to the one in .chrb-matrix.yml",
+				Arguments: []cli.Argument{
+					&cli.StringArg{
+						Name: "command",
+						Min:  0,
+						Max:  1,
+					},
+					&cli.StringArg{
+						Name: "arguments",
+						Min:  0,
+						Max:  -1,
+					},
+				},
+
+				Flags: []cli.Flag{
+					&cli.StringSliceFlag{
+						Name:  "ruby",
+						Usage: "the rubies to run the command on: all, an engine, an optional engine and version constraint like 'ruby >= 3.1', or a ruby pattern",
+					},
+					&cli.StringFlag{
+						Name:  "file",
+						Usage: "the matrix file declaring rubies, axes and the command, defaulting to the nearest .chrb-matrix.yml when --ruby or the command is missing",
+					},
+					&cli.StringFlag{
+						Name:  "limit-memory",
+						Usage: "the most virtual memory each run may use, like 2G, except on macOS",
+					},
+					&cli.DurationFlag{
+						Name:  "limit-cpu",
+						Usage: "the most CPU time each run may use, rounded to seconds",
+					},
+					&cli.IntFlag{
+						Name:  "limit-files",
+						Usage: "the most files each run may have open",
+					},
+					&cli.StringSliceFlag{
+						Name:  "gemfile",
+						Usage: "gemfiles to run each ruby with, as paths or globs like gemfiles/*.gemfile relative to the matrix file or working directory, setting BUNDLE_GEMFILE",
+					},
+					&cli.BoolFlag{
+						Name:  "bundle-install",
+						Usage: "run bundle install in each cell before the command",
+					},
+					&cli.StringSliceFlag{
+						Name:  "exclude",
+						Usage: "rubies to leave out, in the same form as --ruby",
+					},
+					&cli.BoolFlag{
+						Name:  "latest-per-minor",
+						Usage: "only run the newest of the selected rubies for each minor version",
+					},
+					&cli.IntFlag{
+						Name:        "jobs",
+						Usage:       "the maximum number of rubies to run the command on at once",
+						Value:       int64(runtime.NumCPU()),
+						DefaultText: "number of CPUs",
+					},
+					&cli.BoolFlag{
+						Name:  "fail-fast",
+						Usage: "stop the remaining runs as soon as one fails",
+					},
+					&cli.DurationFlag{
+						Name:  "grace-period",
+						Usage: "how long stopped runs get to exit after SIGTERM before they are killed",
+						Value: 10 * time.Second,
+					},
+					&cli.DurationFlag{
+						Name:  "timeout",
+						Usage: "stop a ruby's run if it takes longer than this, 0 for no limit",
+					},
+					&cli.IntFlag{
+						Name:  "retries",
+						Usage: "the number of times to retry a failing run",
+					},
+					&cli.BoolFlag{
+						Name:  "isolate",
+						Usage: "run each cell in its own copy of the working directory, so runs don't share files like Gemfile.lock or tmp/",
+					},
+					&cli.StringFlag{
+						Name:  "isolate-with",
+						Usage: "copy, using copy-on-write where supported, or worktree, for a git worktree of HEAD",
+						Value: "copy",
+					},
+					&cli.BoolFlag{
+						Name:  "keep",
+						Usage: "keep the isolated working directories after the matrix finishes",
+					},
+					&cli.BoolFlag{
+						Name:  "summary-only",
+						Usage: "leave out the output of passing runs, only showing failures and the summary",
+					},
+					&cli.BoolFlag{
+						Name:  "stream",
+						Usage: "print each line of output as it arrives, labelled with its ruby, instead of showing progress",
+					},
+					&cli.StringFlag{
+						Name:  "log-dir",
+						Usage: "also write each ruby's output to <dir>/<ruby>.log, headed by the command and environment",
+					},
+					&cli.BoolFlag{
+						Name:  "split-logs",
+						Usage: "with --log-dir, also write stdout and stderr to <ruby>.stdout.log and <ruby>.stderr.log",
+					},
+					&cli.StringSliceFlag{
+						Name:  "report",
+						Usage: "write a report of the results as format=path, where format is json, junit or tap and - is stdout",
+					},
+				},
+				Action: execMatrix,
+			},
+			{
+				Name:  "bench",
+				Usage: "time a command on several rubies, one after another, and compare them with a baseline",
 				Arguments: []cli.Argument{
 					&cli.StringArg{
 						Name: "command",
-						Min:  1,
+						Min:  0,
 						Max:  1,
 					},
 					&cli.StringArg{
@@ -109,11 +362,46 @@ func App(config *Config) *cli.Command {
 				Flags: []cli.Flag{
 					&cli.StringSliceFlag{
 						Name:     "ruby",
-						Usage:    "the rubies to run the command on",
+						Usage:    "the rubies to benchmark, in the same form as matrix --ruby",
 						Required: true,
 					},
+					&cli.StringSliceFlag{
+						Name:  "exclude",
+						Usage: "rubies to leave out, in the same form as --ruby",
+					},
+					&cli.BoolFlag{
+						Name:  "latest-per-minor",
+						Usage: "only benchmark the newest of the selected rubies for each minor version",
+					},
+					&cli.StringFlag{
+						Name:  "baseline",
+						Usage: "the ruby to compare the others with, defaulting to the first one",
+					},
+					&cli.IntFlag{
+						Name:  "runs",
+						Usage: "the number of timed runs for each ruby",
+						Value: 10,
+					},
+					&cli.IntFlag{
+						Name:  "warmup",
+						Usage: "the number of untimed runs for each ruby before the timed ones",
+						Value: 1,
+					},
+					&cli.DurationFlag{
+						Name:  "grace-period",
+						Usage: "how long stopped runs get to exit after SIGTERM before they are killed",
+						Value: 10 * time.Second,
+					},
+					&cli.DurationFlag{
+						Name:  "timeout",
+						Usage: "stop a run if it takes longer than this, 0 for no limit",
+					},
+					&cli.StringFlag{
+						Name:  "json",
+						Usage: "write the timings and statistics as JSON to a path, where - is stdout",
+					},
 				},
-				Action: execMatrix,
+				Action: execBench,
 			},
 		},
 		Action: func(ctx context.Context, cmd *cli.Command) error {
@@ -122,6 +410,20 @@ func App(config *Config) *cli.Command {
 	}
 }
 
+// inheritWriters points the subcommands of cmd at its writers, which they
+// would otherwise default to os.Stdout and os.Stderr for.
+func inheritWriters(cmd *cli.Command) {
+	for _, sub := range cmd.Commands {
+		if sub.Writer == nil {
+			sub.Writer = cmd.Writer
+		}
+		if sub.ErrWriter == nil {
+			sub.ErrWriter = cmd.ErrWriter
+		}
+		inheritWriters(sub)
+	}
+}
+
 func listRubies(ctx context.Context, cmd *cli.Command) error {
 	config := GetConfig(ctx)
 
@@ -163,216 +465,384 @@ func useRuby(ctx context.Context, cmd *cli.Command) error {
 		pattern = found
 	}
 
-	env := config.Env.Clone()
-	env.ResetRubyEnv(config.Uid)
-
 	ruby, err := FindRuby(pattern, config)
 	if err != nil {
 		return err
 	}
 
-	env, err = ruby.Env(config)
+	env, err := ruby.Env(config)
+	if err != nil {
+		return err
+	}
+	if err := CreateProjectGemset(config); err != nil {
+		return err
+	}
+
+	shell, err := shellFor(config, cmd)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprint(cmd.Writer, shell.Render(env.Ops(config.Env)))
+	return err
+}
+
+// shellFor picks the shell to render for from --shell, falling back to
+// $SHELL. An unknown $SHELL, like tcsh or nu, gets posix output rather than
+// an error, since only an explicit --shell has to be one chrb supports.
+func shellFor(config *Config, cmd *cli.Command) (Shell, error) {
+	if name := cmd.String("shell"); len(name) > 0 {
+		return ParseShell(name)
+	}
+	shell, err := ParseShell(config.Env.Getenv("SHELL"))
+	if err != nil {
+		return ShellPosix, nil
+	}
+	return shell, nil
+}
+
+func currentRuby(ctx context.Context, cmd *cli.Command) error {
+	config := GetConfig(ctx)
+
+	var ruby Ruby
+	var err error
+	if rubyRoot := config.Env.Getenv("RUBY_ROOT"); len(rubyRoot) > 0 {
+		ruby, err = RubyFromDir(config, RubyDir(rubyRoot))
+	} else {
+		ruby, err = ResolveRuby(config, cmd.Root().String("default-ruby-version"))
+	}
 	if err != nil {
 		return err
 	}
 
-	for _, e := range env.Diff(config.Env.ToEnvList()) {
-		if e.Value != nil {
-			fmt.Fprintf(cmd.Writer, "export %s=%s\n", e.Key, strconv.Quote(*e.Value))
+	env, err := ruby.Env(config)
+	if err != nil {
+		return err
+	}
+	project, err := config.Project()
+	if err != nil {
+		return err
+	}
+
+	current := struct {
+		Ruby         Ruby         `json:"ruby"`
+		Project      *Project     `json:"project,omitempty"`
+		GemHome      string       `json:"gem_home,omitempty"`
+		GemHomeScope GemHomeScope `json:"gem_home_scope,omitempty"`
+	}{Ruby: ruby, Project: project}
+	if gemHome, ok := env.LookupEnv("GEM_HOME"); ok && config.Uid != 0 {
+		current.GemHome = gemHome
+		if _, ok := env.LookupEnv("CHRB_GEM_HOME"); ok {
+			current.GemHomeScope = GemHomeScopeGemset
 		} else {
-			fmt.Fprintf(cmd.Writer, "unset %s\n", e.Key)
+			_, current.GemHomeScope = project.MergeOptions(config.Options).GemHome(env, project)
+		}
+	}
+
+	switch format := cmd.String("format"); format {
+	case "json":
+		return json.NewEncoder(cmd.Writer).Encode(current)
+	case "text":
+		fmt.Fprintf(cmd.Writer, "%s %s (%s)\n", ruby.Engine, ruby.Version, ruby.RubyDir)
+		if project != nil {
+			fmt.Fprintf(cmd.Writer, "project: %s\n", project.Root)
+		}
+		if len(current.GemHome) > 0 {
+			fmt.Fprintf(cmd.Writer, "gem home: %s (%s scope)\n", current.GemHome, current.GemHomeScope)
 		}
+	default:
+		return fmt.Errorf("invalid format: %q", format)
 	}
 
 	return nil
 }
 
-func execRuby(ctx context.Context, cmd *cli.Command) error {
+func listGemsets(ctx context.Context, cmd *cli.Command) error {
 	config := GetConfig(ctx)
 
-	if cmd.NArg() < 2 {
-		return fmt.Errorf("usage: chrb exec <ruby> <command>")
+	gemsets, err := ListGemsets(config)
+	if err != nil {
+		return err
+	}
+
+	switch format := cmd.String("format"); format {
+	case "json":
+		return json.NewEncoder(cmd.Writer).Encode(gemsets)
+	case "text":
+		project, err := config.Project()
+		if err != nil {
+			return err
+		}
+		for _, gemset := range gemsets {
+			activeString := " "
+			if project != nil && project.Root == gemset.Project {
+				activeString = "*"
+			}
+			projectString := gemset.Project
+			if exists, _ := afero.DirExists(config.Fs, gemset.Project); !exists {
+				projectString += " (missing)"
+			}
+			rubies, err := gemset.Rubies(config)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.Writer, " %s %s %s [%s]\n", activeString, gemset.Name, projectString, strings.Join(rubies, ", "))
+		}
+	default:
+		return fmt.Errorf("invalid format: %q", format)
 	}
-	pattern := cmd.Args().First()
-	command := cmd.Args().Tail()
 
-	env := config.Env.Clone()
-	env.ResetRubyEnv(config.Uid)
+	return nil
+}
 
-	ruby, err := FindRuby(pattern, config)
+func removeGemset(ctx context.Context, cmd *cli.Command) error {
+	config := GetConfig(ctx)
+
+	if cmd.NArg() > 1 {
+		return fmt.Errorf("usage: chrb gemset rm [project dir|gemset name]")
+	}
+
+	gemsets, err := ListGemsets(config)
 	if err != nil {
 		return err
 	}
 
-	env, err = ruby.Env(config)
+	var project *Project
+	if arg := cmd.Args().First(); len(arg) > 0 {
+		for _, gemset := range gemsets {
+			if gemset.Name == arg {
+				return gemset.Remove(config)
+			}
+		}
+		project, err = FindProject(config, arg)
+	} else {
+		project, err = config.Project()
+		if project == nil && err == nil {
+			err = ErrNoRubyVersion
+		}
+	}
 	if err != nil {
 		return err
 	}
 
-	command = append([]string{"chruby exec"}, command...)
-	return syscall.Exec("/usr/bin/env", command, env.ToEnvList())
+	// the project's options can put its gemset somewhere other than the
+	// gemsets listed for the current directory
+	gemset := ProjectGemset(config.Env, project.MergeOptions(config.Options), project)
+	exists, err := afero.DirExists(config.Fs, gemset.Dir)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return gemset.Remove(config)
+	}
+	return fmt.Errorf("no gemset found for %s", project.Root)
 }
 
-type runResult struct {
-	pattern string
-	ruby    *Ruby
-	stdout  string
-	exit    string
-	time    time.Duration
-	err     error
+// argProject finds the project for an optional directory argument,
+// defaulting to the current one.
+func argProject(config *Config, cmd *cli.Command) (*Project, error) {
+	if cmd.NArg() > 1 {
+		return nil, fmt.Errorf("usage: %s [project dir]", cmd.FullName())
+	}
+	if arg := cmd.Args().First(); len(arg) > 0 {
+		return FindProject(config, arg)
+	}
+	project, err := config.Project()
+	if project == nil && err == nil {
+		err = ErrNoRubyVersion
+	}
+	return project, err
 }
 
-func (r *runResult) String() string {
-	if r.time > 0 {
-		return fmt.Sprintf("%s (%s %s) -> %s in %s", r.pattern, r.ruby.Engine, r.ruby.Version, r.exit, r.time.Round(time.Millisecond))
+func trustProject(ctx context.Context, cmd *cli.Command) error {
+	config := GetConfig(ctx)
+
+	project, err := argProject(config, cmd)
+	if err != nil {
+		return err
+	}
+	if err := TrustProject(config, project.Root); err != nil {
+		return err
 	}
-	return fmt.Sprintf("%s (%s %s)", r.pattern, r.ruby.Engine, r.ruby.Version)
+	fmt.Fprintf(cmd.Writer, "trusted %s\n", project.Root)
+	return nil
 }
 
-func execMatrix(ctx context.Context, cmd *cli.Command) error {
-	rubies := cmd.StringSlice("ruby")
-
+func listTrustedProjects(ctx context.Context, cmd *cli.Command) error {
 	config := GetConfig(ctx)
-	env := config.Env.Clone()
-	env.ResetRubyEnv(config.Uid)
 
-	envs := []struct {
-		env  []string
-		ruby *Ruby
-	}{}
+	roots, err := TrustedProjects(config)
+	if err != nil {
+		return err
+	}
+	for _, root := range roots {
+		if exists, _ := afero.DirExists(config.Fs, root); !exists {
+			root += " (missing)"
+		}
+		fmt.Fprintln(cmd.Writer, root)
+	}
+	return nil
+}
+
+func untrustProject(ctx context.Context, cmd *cli.Command) error {
+	config := GetConfig(ctx)
 
-	for _, ruby := range rubies {
-		ruby, err := FindRuby(ruby, config)
-		if err != nil {
+	// a project that has since been deleted can still be removed by its root
+	root := ""
+	project, err := argProject(config, cmd)
+	if err == nil {
+		root = project.Root
+	} else if arg := cmd.Args().First(); cmd.NArg() == 1 && len(arg) > 0 {
+		if root, err = filepath.Abs(arg); err != nil {
 			return err
 		}
-		env, err := ruby.Env(config)
+	} else {
+		return err
+	}
+	removed, err := UntrustProject(config, root)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return fmt.Errorf("%s is not trusted", root)
+	}
+	return nil
+}
+
+// execArgs picks the ruby and command for exec. The ruby comes from --ruby,
+// a pattern argument followed by dashes (chrb exec 3.3 -- rake), or else the
+// project in the current directory, falling back to the default ruby.
+func execArgs(ctx context.Context, config *Config, cmd *cli.Command) (Ruby, []string, error) {
+	args := withDashArgs(ctx, cmd.Args().Slice())
+	dashes := slices.Index(args, "--")
+	if dashes >= 0 {
+		args = slices.Delete(args, dashes, dashes+1)
+	}
+
+	if pattern := cmd.String("ruby"); len(pattern) > 0 {
+		ruby, err := FindRuby(pattern, config)
+		return ruby, args, err
+	}
+
+	// without dashes separating them, a pattern can't be told apart from a
+	// command, as in chrb exec ruby foo.rb, so it's all the command
+	if dashes == 1 {
+		ruby, err := FindRuby(args[0], config)
+		return ruby, args[1:], err
+	}
+
+	ruby, err := ResolveRuby(config, cmd.Root().String("default-ruby-version"))
+	return ruby, args, err
+}
+
+func execRuby(ctx context.Context, cmd *cli.Command) error {
+	config := GetConfig(ctx)
+
+	ruby, command, err := execArgs(ctx, config, cmd)
+	if err != nil {
+		return err
+	}
+	if len(command) == 0 {
+		return fmt.Errorf("usage: chrb exec [--ruby <ruby>] -- <command>")
+	}
+
+	env, err := ruby.Env(config)
+	if err != nil {
+		return err
+	}
+	if err := CreateProjectGemset(config); err != nil {
+		return err
+	}
+
+	if cmd.Bool("bundle") {
+		command = append([]string{"bundle", "exec"}, command...)
+	}
+
+	// a command missing from the ruby would otherwise resolve back to its
+	// own shim and loop forever
+	env.Apply([]EnvOp{{Kind: EnvOpRemove, Key: "PATH", Value: config.Options.ShimsDir(config.Env)}})
+
+	path, err := env.LookPath(config.Fs, command[0])
+	if errors.Is(err, ErrCommandNotFound) {
+		return fmt.Errorf("%s: command not found in %s %s", command[0], ruby.Engine, ruby.Version)
+	}
+	if err != nil {
+		return err
+	}
+
+	if cmd.Bool("no-exec") || runtime.GOOS == "windows" {
+		status, err := RunCommand(ctx, path, command, env)
 		if err != nil {
 			return err
 		}
-		envs = append(envs, struct {
-			env  []string
-			ruby *Ruby
-		}{env.ToEnvList(), &ruby})
+		if status != 0 {
+			return cli.Exit("", status)
+		}
+		return nil
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	return syscall.Exec(path, command, env.ToEnvList())
+}
 
-	signals := make(chan os.Signal, 1)
-	signal.Notify(signals, os.Interrupt)
+func initShell(ctx context.Context, cmd *cli.Command) error {
+	if cmd.NArg() != 1 {
+		return fmt.Errorf("usage: chrb init <bash|zsh|fish>")
+	}
 
-	go func() {
-		select {
-		case <-signals:
-			fmt.Fprintln(cmd.Writer, "Interrupted")
-			cancel()
-		case <-ctx.Done():
-		}
-	}()
-
-	pw := progress.NewWriter()
-	pw.SetAutoStop(true)
-	pw.SetOutputWriter(cmd.Writer)
-	pw.SetNumTrackersExpected(len(rubies))
-	style := progress.StyleDefault
-	style.Visibility.TrackerOverall = false
-	style.Visibility.ETA = false
-	style.Visibility.ETAOverall = false
-	style.Visibility.Percentage = false
-	style.Visibility.Value = false
-	style.Options.TimeDonePrecision = time.Millisecond
-	pw.SetStyle(style)
-	go func() {
-		pw.Render()
-	}()
-
-	results := make(chan runResult)
-
-	arg := *cmd.Arguments[1].(*cli.StringArg).Values
-	if len(arg) > 0 && arg[0] == "--" {
-		arg = arg[1:]
-	}
-	arg0 := *cmd.Arguments[0].(*cli.StringArg).Values
-	arg = append(arg0, arg...)
-
-	for i, env := range envs {
-		pattern := rubies[i]
-		tracker := &progress.Tracker{
-			Message: pattern,
-			Total:   0,
-		}
-		pw.AppendTracker(tracker)
-		go func(env struct {
-			env  []string
-			ruby *Ruby
-		}) {
-			result := &runResult{pattern: pattern, ruby: env.ruby}
-			tracker.UpdateMessage(result.String())
-			defer func() {
-				tracker.UpdateMessage(result.String())
-				if result.err != nil {
-					tracker.MarkAsErrored()
-				} else {
-					tracker.MarkAsDone()
-				}
-			}()
-			cmd := exec.CommandContext(ctx, "env", arg...)
-			cmd.Env = env.env
-			stdout := bytes.NewBuffer(nil)
-			cmd.Stdout = stdout
-			cmd.Stderr = stdout
-
-			start := time.Now()
-			err := cmd.Run()
-			duration := time.Since(start)
-
-			result.stdout = stdout.String()
-			result.exit = cmd.ProcessState.String()
-			result.time = duration
-			result.err = err
-			results <- *result
-		}(env)
-	}
-
-	resultsSlice := []runResult{}
-
-	for range rubies {
-		resultsSlice = append(resultsSlice, <-results)
-	}
-
-	errs := []error{}
-
-	sort.Slice(resultsSlice, func(i, j int) bool {
-		return resultsSlice[i].pattern < resultsSlice[j].pattern
-	})
-
-	width, _, err := term.GetSize(int(os.Stdout.Fd()))
+	chrbPath, err := os.Executable()
 	if err != nil {
-		width = 80
+		return err
 	}
-	width -= 2
-	header := strings.Repeat("*", width)
 
-	for i, result := range resultsSlice {
-		if result.err != nil {
-			errs = append(errs, multierror.Prefix(result.err, result.pattern))
-		}
-		if i > 0 {
-			fmt.Fprintln(cmd.Writer)
-		}
-		fmt.Fprintln(cmd.Writer, header)
-		label := result.String()
-		label = strings.Repeat("-", (width-len(label))/2) + label + strings.Repeat("-", (width-len(label))/2)
-		fmt.Fprintln(cmd.Writer, label)
-		cmd.Writer.Write([]byte(result.stdout))
-		fmt.Fprintln(cmd.Writer, label)
-		fmt.Fprintln(cmd.Writer, header)
+	script, err := InitScript(cmd.Args().First(), chrbPath)
+	if err != nil {
+		return err
 	}
+	_, err = fmt.Fprint(cmd.Writer, script)
+	return err
+}
+
+func hookEnv(ctx context.Context, cmd *cli.Command) error {
+	config := GetConfig(ctx)
 
-	if len(errs) > 0 {
-		return multierror.Append(nil, errs...)
+	shell, err := shellFor(config, cmd)
+	if err != nil {
+		return err
 	}
 
+	ops, hookErr := HookEnv(config)
+	if _, err := fmt.Fprint(cmd.Writer, shell.Render(ops)); err != nil {
+		return err
+	}
+	if hookErr != nil {
+		fmt.Fprintf(cmd.Root().ErrWriter, "chrb: %s\n", hookErr)
+	}
+	return nil
+}
+
+func writeShims(ctx context.Context, cmd *cli.Command) error {
+	config := GetConfig(ctx)
+
+	chrbPath, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	names, err := ShimNames(config, cmd.ErrWriter)
+	if err != nil {
+		return err
+	}
+
+	dir := config.Options.ShimsDir(config.Env)
+	added, removed, err := WriteShims(config, dir, chrbPath, names)
+	if err != nil {
+		return err
+	}
+
+	if cmd.Name == "rehash" {
+		fmt.Fprintf(cmd.Writer, "%d shims, %d added, %d removed\n", len(names), len(added), len(removed))
+		return nil
+	}
+	fmt.Fprintf(cmd.Writer, "wrote %d shims to %s, add it to the front of PATH to use them\n", len(names), dir)
 	return nil
 }
@@ -0,0 +1,247 @@
+package chrb_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/segiddins/chrb"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli/v3"
+)
+
+// testPath is saved before TestChrb clears the environment, to find sh, env,
+// cp and git.
+var testPath = os.Getenv("PATH")
+
+// runApp runs chrb with args, returning everything it printed.
+func runApp(config *chrb.Config, args ...string) (string, error) {
+	app := chrb.App(config)
+	out := &bytes.Buffer{}
+	app.Writer = out
+	app.ErrWriter = out
+	app.ExitErrHandler = func(context.Context, *cli.Command, error) {}
+	err := chrb.Run(context.Background(), app, append([]string{"chrb"}, args...))
+	return out.String(), err
+}
+
+// exitStatus is the status chrb would exit with after err.
+func exitStatus(err error) int {
+	var exitErr cli.ExitCoder
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	if err != nil {
+		return 1
+	}
+	return 0
+}
+
+// fakeRuby and fakeBundle append their arguments to $CHRB_TEST_LOG.
+const (
+	fakeRuby = `#!/bin/sh
+echo "ruby $RUBY_VERSION $*" >>"$CHRB_TEST_LOG"
+`
+	fakeBundle = `#!/bin/sh
+echo "bundle $*" >>"$CHRB_TEST_LOG"
+if [ "$1" = exec ]; then shift; exec "$@"; fi
+`
+)
+
+// newRunConfig makes a config for commands that start real processes, with
+// fake rubies for versions in a temporary HOME, and a project pinned to the
+// first of them as the working directory. The rubies log what they were run
+// with to the returned path.
+func newRunConfig(t *testing.T, versions ...string) (*chrb.Config, string) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake rubies are shell scripts")
+	}
+	if len(shells["sh"]) == 0 {
+		t.Skip("sh not found")
+	}
+	home := t.TempDir()
+	for _, version := range versions {
+		bin := filepath.Join(home, ".rubies", "ruby-"+version, "bin")
+		assert.NoError(t, os.MkdirAll(bin, 0755))
+		assert.NoError(t, os.WriteFile(filepath.Join(bin, "ruby"), []byte(fakeRuby), 0755))
+		assert.NoError(t, os.WriteFile(filepath.Join(bin, "bundle"), []byte(fakeBundle), 0755))
+	}
+	project := filepath.Join(home, "app")
+	assert.NoError(t, os.MkdirAll(project, 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(project, ".ruby-version"), []byte(versions[0]+"\n"), 0644))
+	log := filepath.Join(home, "log")
+
+	config := &chrb.Config{
+		Fs:      afero.NewOsFs(),
+		Env:     chrb.ParseEnv([]string{"HOME=" + home, "PATH=" + testPath, "CHRB_TEST_LOG=" + log}),
+		Uid:     0,
+		Dir:     project,
+		Options: chrb.DefaultOptions.Clone(),
+		RubyEnvFinder: func(r *chrb.Ruby) ([]string, error) {
+			return []string{"RUBY_ENGINE=" + r.Engine, "RUBY_VERSION=" + r.Version}, nil
+		},
+	}
+	return config, log
+}
+
+// readLog returns what the fake rubies logged so far, and clears it.
+func readLog(t *testing.T, log string) string {
+	content, err := os.ReadFile(log)
+	if errors.Is(err, os.ErrNotExist) {
+		return ""
+	}
+	assert.NoError(t, err)
+	assert.NoError(t, os.Remove(log))
+	return string(content)
+}
+
+func TestUse_Shell(t *testing.T) {
+	config := &chrb.Config{
+		Fs:      afero.NewMemMapFs(),
+		Env:     chrb.ParseEnv([]string{"HOME=/Users/user", "PATH=/usr/bin"}),
+		Uid:     0,
+		Options: chrb.DefaultOptions.Clone(),
+		RubyEnvFinder: func(r *chrb.Ruby) ([]string, error) {
+			return []string{"RUBY_ENGINE=" + r.Engine, "RUBY_VERSION=" + r.Version}, nil
+		},
+	}
+	rubyDir := chrb.RubyDir("/opt/rubies/ruby-3.3.6")
+	assert.NoError(t, afero.WriteFile(config.Fs, rubyDir.ExecPath(), []byte("ruby"), 0755))
+
+	tests := []struct {
+		name  string
+		env   string
+		args  []string
+		want  string
+		error string
+	}{
+		{name: "bash", env: "SHELL=/bin/bash", want: "export RUBY_ROOT='/opt/rubies/ruby-3.3.6'\n"},
+		{name: "fish", env: "SHELL=/usr/local/bin/fish", want: "set -gx RUBY_ROOT '/opt/rubies/ruby-3.3.6'\n"},
+		{name: "unknown $SHELL", env: "SHELL=/bin/tcsh", want: "export RUBY_ROOT='/opt/rubies/ruby-3.3.6'\n"},
+		{name: "--shell over $SHELL", env: "SHELL=/bin/tcsh", args: []string{"--shell", "fish"}, want: "set -gx RUBY_ROOT '/opt/rubies/ruby-3.3.6'\n"},
+		{name: "unknown --shell", env: "SHELL=/bin/bash", args: []string{"--shell", "tcsh"}, error: `unsupported shell: "tcsh"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config.Env = chrb.ParseEnv([]string{"HOME=/Users/user", "PATH=/usr/bin", test.env})
+			args := append([]string{"use"}, test.args...)
+			out, err := runApp(config, append(args, "3.3")...)
+			if len(test.error) > 0 {
+				assert.EqualError(t, err, test.error)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Contains(t, out, test.want)
+			}
+		})
+	}
+}
+
+func TestExec_Dashes(t *testing.T) {
+	config, log := newRunConfig(t, "3.3.6", "3.4.1")
+
+	tests := []struct {
+		args   []string
+		status int
+		log    string
+	}{
+		{args: []string{"exec", "--no-exec", "--", "ruby", "-v"}, log: "ruby 3.3.6 -v\n"},
+		{args: []string{"exec", "--no-exec", "3.4", "--", "ruby", "-v"}, log: "ruby 3.4.1 -v\n"},
+		{args: []string{"exec", "--no-exec", "--ruby", "3.4", "--", "ruby", "-v"}, log: "ruby 3.4.1 -v\n"},
+		{args: []string{"exec", "--ruby=3.4", "--no-exec", "--", "ruby", "-e", "--", "-w"}, log: "ruby 3.4.1 -e -- -w\n"},
+		{args: []string{"exec", "--no-exec", "--ruby=3.4", "--", "sh", "-c", "exit 7"}, status: 7},
+	}
+
+	for _, test := range tests {
+		t.Run(strings.Join(test.args, " "), func(t *testing.T) {
+			_, err := runApp(config, test.args...)
+			assert.Equal(t, test.status, exitStatus(err), "%v", err)
+			assert.Equal(t, test.log, readLog(t, log))
+		})
+	}
+}
+
+func TestExec_BundleAndNoExec(t *testing.T) {
+	config, log := newRunConfig(t, "3.3.6", "3.4.1")
+
+	tests := []struct {
+		args   []string
+		status int
+		log    string
+	}{
+		// ruby is the command rather than a pattern, even though it would
+		// find a ruby
+		{args: []string{"exec", "--no-exec", "--", "ruby", "foo"}, log: "ruby 3.3.6 foo\n"},
+		{args: []string{"exec", "--no-exec", "ruby", "foo.rb"}, log: "ruby 3.3.6 foo.rb\n"},
+		{args: []string{"exec", "--bundle", "--no-exec", "--", "ruby", "-w", "foo"}, log: "bundle exec ruby -w foo\nruby 3.3.6 -w foo\n"},
+		{args: []string{"exec", "--no-exec", "--bundle", "--ruby", "3.4", "--", "ruby", "-v"}, log: "bundle exec ruby -v\nruby 3.4.1 -v\n"},
+		{args: []string{"exec", "--no-exec", "--bundle", "3.4", "--", "sh", "-c", "exit 3"}, status: 3, log: "bundle exec sh -c exit 3\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(strings.Join(test.args, " "), func(t *testing.T) {
+			_, err := runApp(config, test.args...)
+			assert.Equal(t, test.status, exitStatus(err), "%v", err)
+			assert.Equal(t, test.log, readLog(t, log))
+		})
+	}
+}
+
+func TestMatrix_Dashes(t *testing.T) {
+	config, log := newRunConfig(t, "3.3.6", "3.4.1")
+	t.Setenv("PATH", testPath)
+
+	_, err := runApp(config, "matrix", "--ruby", "3.4", "--", "ruby", "-v")
+	assert.NoError(t, err)
+	assert.Equal(t, "ruby 3.4.1 -v\n", readLog(t, log))
+
+	_, err = runApp(config, "matrix", "--ruby", "3.3", "ruby", "--", "-e", "1")
+	assert.NoError(t, err)
+	assert.Equal(t, "ruby 3.3.6 -e 1\n", readLog(t, log))
+}
+
+func TestTrust(t *testing.T) {
+	config := &chrb.Config{
+		Fs:      afero.NewMemMapFs(),
+		Env:     chrb.ParseEnv([]string{"HOME=/Users/user"}),
+		Dir:     "/src/app/lib",
+		Options: chrb.DefaultOptions.Clone(),
+	}
+	assert.NoError(t, config.Fs.MkdirAll(config.Dir, 0755))
+	assert.NoError(t, afero.WriteFile(config.Fs, "/src/app/.ruby-version", []byte("3.3.6\n"), 0644))
+	assert.NoError(t, afero.WriteFile(config.Fs, "/src/other/.ruby-version", []byte("3.4.1\n"), 0644))
+
+	out, err := runApp(config, "trust")
+	assert.NoError(t, err)
+	assert.Equal(t, "trusted /src/app\n", out)
+	_, err = runApp(config, "trust", "/src/other")
+	assert.NoError(t, err)
+	_, err = runApp(config, "trust")
+	assert.NoError(t, err)
+
+	out, err = runApp(config, "trust", "list")
+	assert.NoError(t, err)
+	assert.Equal(t, "/src/app\n/src/other\n", out)
+	content, err := afero.ReadFile(config.Fs, "/Users/user/.config/chrb/trusted")
+	assert.NoError(t, err)
+	assert.Equal(t, "/src/app\n/src/other\n", string(content))
+
+	_, err = runApp(config, "trust", "rm")
+	assert.NoError(t, err)
+	assert.NoError(t, config.Fs.RemoveAll("/src/other"))
+	out, err = runApp(config, "trust", "list")
+	assert.NoError(t, err)
+	assert.Equal(t, "/src/other (missing)\n", out)
+	_, err = runApp(config, "trust", "rm", "/src/other")
+	assert.NoError(t, err)
+
+	_, err = runApp(config, "trust", "rm")
+	assert.EqualError(t, err, "/src/app is not trusted")
+}
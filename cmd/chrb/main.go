@@ -10,16 +10,32 @@ import (
 )
 
 func main() {
+	dir, err := os.Getwd()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+
 	config := chrb.Config{
 		Env:           chrb.ParseEnv(os.Environ()),
 		Options:       chrb.DefaultOptions.Clone(),
 		Uid:           os.Getuid(),
+		Dir:           dir,
 		Fs:            afero.NewOsFs(),
 		RubyEnvFinder: chrb.ExecFindEnv,
 	}
+
+	userOptions, err := chrb.ReadOptionsFile(config.Fs, chrb.UserOptionsPath(config.Env))
+	if err == nil {
+		config.Options.Merge(userOptions)
+	} else if !os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+
 	app := chrb.App(&config)
 
-	if err := app.Run(context.Background(), os.Args); err != nil {
+	if err := chrb.Run(context.Background(), app, os.Args); err != nil {
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
 		os.Exit(1)
 	}
@@ -1,10 +1,13 @@
 package main
 
 import (
+	"fmt"
 	"os"
+	"strings"
 
 	"github.com/segiddins/chrb"
 	docs "github.com/urfave/cli-docs/v3"
+	"github.com/urfave/cli/v3"
 )
 
 func main() {
@@ -14,6 +17,7 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
+	md = defaultTexts(app, md)
 
 	fi, err := os.Create("cli-docs.md")
 	if err != nil {
@@ -24,3 +28,26 @@ func main() {
 		panic(err)
 	}
 }
+
+// defaultTexts replaces the defaults cli-docs prints for flags with a
+// DefaultText, since it always prints the flag's value, which for --jobs
+// depends on the machine generating the docs.
+func defaultTexts(cmd *cli.Command, md string) string {
+	for _, flag := range cmd.Flags {
+		f, ok := flag.(*cli.IntFlag)
+		if !ok || len(f.DefaultText) == 0 {
+			continue
+		}
+		lines := strings.Split(md, "\n")
+		for i, line := range lines {
+			if strings.HasPrefix(line, "**--"+f.Name+"**") {
+				lines[i] = strings.Replace(line, fmt.Sprintf("(default: %d)", f.Value), "(default: "+f.DefaultText+")", 1)
+			}
+		}
+		md = strings.Join(lines, "\n")
+	}
+	for _, sub := range cmd.Commands {
+		md = defaultTexts(sub, md)
+	}
+	return md
+}
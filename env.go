@@ -115,6 +115,52 @@ func (e *Env) Getenv(key string) string {
 	return v
 }
 
+func (e *Env) field(key string) **string {
+	switch key {
+	case "RUBY_ROOT":
+		return &e.RubyRoot
+	case "RUBY_ENGINE":
+		return &e.RubyEngine
+	case "RUBY_VERSION":
+		return &e.RubyVersion
+	case "RUBY_API_VERSION":
+		return &e.RubyApiVersion
+	case "RUBYOPT":
+		return &e.RubyOpt
+	case "GEM_ROOT":
+		return &e.GemRoot
+	case "GEM_PATH":
+		return &e.GemPath
+	case "GEM_HOME":
+		return &e.GemHome
+	case "HOME":
+		return &e.Home
+	case "PATH":
+		return &e.Path
+	case "PREFIX":
+		return &e.Prefix
+	}
+	return nil
+}
+
+func (e *Env) Setenv(key, value string) {
+	if f := e.field(key); f != nil {
+		*f = &value
+		return
+	}
+	if e.Rest == nil {
+		e.Rest = map[string]*string{}
+	}
+	e.Rest[key] = &value
+}
+
+func (e *Env) Unsetenv(key string) {
+	if f := e.field(key); f != nil {
+		*f = nil
+	}
+	delete(e.Rest, key)
+}
+
 func (e *Env) ToEnvList() []string {
 	envList := []string{}
 	if e.RubyRoot != nil {
@@ -165,6 +211,9 @@ func (e *Env) ResetRubyEnv(uid int) {
 		return
 	}
 
+	e.resetEnvRules()
+	e.resetRubyOpt()
+
 	path := filepath.SplitList(e.Getenv("PATH"))
 	path = deleteElement(path, filepath.Join(rubyRoot, "bin"))
 
@@ -187,6 +236,12 @@ func (e *Env) ResetRubyEnv(uid int) {
 			gemPath = deleteElement(gemPath, gemRoot)
 		}
 
+		if sharedGemHome := e.Getenv("CHRB_GEM_HOME"); len(sharedGemHome) > 0 {
+			path = deleteElement(path, filepath.Join(sharedGemHome, "bin"))
+			gemPath = deleteElement(gemPath, sharedGemHome)
+		}
+		e.Unsetenv("CHRB_GEM_HOME")
+
 		if len(gemPath) > 0 {
 			gemPathString := strings.Join(gemPath, string(os.PathListSeparator))
 			e.GemPath = &gemPathString
@@ -203,7 +258,6 @@ func (e *Env) ResetRubyEnv(uid int) {
 	e.RubyEngine = nil
 	e.RubyVersion = nil
 	e.RubyApiVersion = nil
-	e.RubyOpt = nil
 	e.GemRoot = nil
 }
 
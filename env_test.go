@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/segiddins/chrb"
+	"github.com/spf13/afero"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -100,3 +101,82 @@ func TestEnv_Diff(t *testing.T) {
 		assert.Equal(t, testCase.diff, diff)
 	}
 }
+
+func TestEnv_RubyOpt(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	rubyDir := chrb.RubyDir("/opt/rubies/ruby-3.3.6")
+	assert.NoError(t, afero.WriteFile(fs, rubyDir.ExecPath(), []byte("ruby"), 0755))
+	assert.NoError(t, fs.MkdirAll("/src/app", 0755))
+	assert.NoError(t, afero.WriteFile(fs, "/src/app/.ruby-version", []byte("3.3.6"), 0644))
+	assert.NoError(t, afero.WriteFile(fs, "/src/app/.chrb.json", []byte(`{"rubyopt": ["-rbundler/setup --yjit"]}`), 0644))
+
+	options := chrb.DefaultOptions.Clone()
+	options.RubyOpt = []string{"-W:deprecated", "--yjit"}
+	config := &chrb.Config{
+		Fs:      fs,
+		Env:     chrb.ParseEnv([]string{"HOME=/Users/user", "RUBYOPT=-w --yjit"}),
+		Uid:     0,
+		Dir:     "/src/app",
+		Options: options,
+		RubyEnvFinder: func(r *chrb.Ruby) ([]string, error) {
+			return []string{"RUBY_ENGINE=" + r.Engine, "RUBY_VERSION=" + r.Version}, nil
+		},
+	}
+
+	ruby, err := chrb.RubyFromDir(config, rubyDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env, err := ruby.Env(config)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "-w --yjit -W:deprecated -rbundler/setup", env.Getenv("RUBYOPT"))
+
+	// flags added after activation are kept by the reset
+	rubyOpt := env.Getenv("RUBYOPT") + " -d"
+	env.RubyOpt = &rubyOpt
+	env.ResetRubyEnv(config.Uid)
+	assert.Equal(t, "-w --yjit -d", env.Getenv("RUBYOPT"))
+
+	config.Env = chrb.ParseEnv([]string{"HOME=/Users/user"})
+	env, err = ruby.Env(config)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "-W:deprecated --yjit -rbundler/setup", env.Getenv("RUBYOPT"))
+	env.ResetRubyEnv(config.Uid)
+	_, ok := env.LookupEnv("RUBYOPT")
+	assert.False(t, ok)
+}
+
+func TestEnv_RubyOpt_FlagArguments(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	rubyDir := chrb.RubyDir("/opt/rubies/ruby-3.3.6")
+	assert.NoError(t, afero.WriteFile(fs, rubyDir.ExecPath(), []byte("ruby"), 0755))
+
+	options := chrb.DefaultOptions.Clone()
+	options.RubyOpt = []string{"-I b -r set", "-I a"}
+	config := &chrb.Config{
+		Fs:      fs,
+		Env:     chrb.ParseEnv([]string{"HOME=/Users/user", "RUBYOPT=-I a -r json"}),
+		Uid:     0,
+		Options: options,
+		RubyEnvFinder: func(r *chrb.Ruby) ([]string, error) {
+			return []string{"RUBY_ENGINE=" + r.Engine, "RUBY_VERSION=" + r.Version}, nil
+		},
+	}
+
+	ruby, err := chrb.RubyFromDir(config, rubyDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env, err := ruby.Env(config)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "-I a -r json -I b -r set", env.Getenv("RUBYOPT"))
+
+	env.ResetRubyEnv(config.Uid)
+	assert.Equal(t, "-I a -r json", env.Getenv("RUBYOPT"))
+}
@@ -0,0 +1,109 @@
+package chrb
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+type EnvOpKind string
+
+const (
+	EnvOpSet     EnvOpKind = "set"
+	EnvOpUnset   EnvOpKind = "unset"
+	EnvOpPrepend EnvOpKind = "prepend"
+	EnvOpRemove  EnvOpKind = "remove"
+)
+
+// EnvOp is a single change to the environment. Prepend and remove edit one
+// entry of a path list in place, so changes other tools made to the rest of
+// the list are kept.
+type EnvOp struct {
+	Kind  EnvOpKind `json:"kind"`
+	Key   string    `json:"key"`
+	Value string    `json:"value,omitempty"`
+}
+
+// pathListKeys are edited entry by entry rather than replaced wholesale.
+var pathListKeys = []string{"PATH"}
+
+// Ops returns the operations that turn original into e.
+func (e *Env) Ops(original *Env) []EnvOp {
+	ops := []EnvOp{}
+	for _, d := range e.Diff(original.ToEnvList()) {
+		if d.Value == nil {
+			ops = append(ops, EnvOp{Kind: EnvOpUnset, Key: d.Key})
+			continue
+		}
+		if slices.Contains(pathListKeys, d.Key) {
+			if old, ok := original.LookupEnv(d.Key); ok {
+				if listOps, ok := pathListOps(d.Key, old, *d.Value); ok {
+					ops = append(ops, listOps...)
+					continue
+				}
+			}
+		}
+		ops = append(ops, EnvOp{Kind: EnvOpSet, Key: d.Key, Value: *d.Value})
+	}
+
+	slices.SortStableFunc(ops, func(a, b EnvOp) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+	return ops
+}
+
+// pathListOps expresses the change from old to new as removals followed by
+// prepends. This is only possible when the entries that survive keep their
+// order and end up after every new entry.
+func pathListOps(key, old, new string) ([]EnvOp, bool) {
+	oldEntries := filepath.SplitList(old)
+	newEntries := filepath.SplitList(new)
+
+	ops := []EnvOp{}
+	kept := []string{}
+	for _, entry := range oldEntries {
+		if slices.Contains(newEntries, entry) {
+			kept = append(kept, entry)
+			continue
+		}
+		op := EnvOp{Kind: EnvOpRemove, Key: key, Value: entry}
+		if !slices.Contains(ops, op) {
+			ops = append(ops, op)
+		}
+	}
+
+	if len(kept) > len(newEntries) {
+		return nil, false
+	}
+	split := len(newEntries) - len(kept)
+	if !slices.Equal(newEntries[split:], kept) {
+		return nil, false
+	}
+	added := newEntries[:split]
+	for i, entry := range added {
+		if slices.Contains(kept, entry) || slices.Contains(added[i+1:], entry) {
+			return nil, false
+		}
+	}
+
+	for _, entry := range slices.Backward(added) {
+		ops = append(ops, EnvOp{Kind: EnvOpPrepend, Key: key, Value: entry})
+	}
+	return ops, true
+}
+
+func (e *Env) Apply(ops []EnvOp) {
+	for _, op := range ops {
+		switch op.Kind {
+		case EnvOpSet:
+			e.Setenv(op.Key, op.Value)
+		case EnvOpUnset:
+			e.Unsetenv(op.Key)
+		case EnvOpPrepend:
+			e.Setenv(op.Key, joinPathList(op.Value, e.Getenv(op.Key)))
+		case EnvOpRemove:
+			entries := deleteElement(filepath.SplitList(e.Getenv(op.Key)), op.Value)
+			e.Setenv(op.Key, joinPathList(entries...))
+		}
+	}
+}
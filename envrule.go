@@ -0,0 +1,160 @@
+package chrb
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// EnvRule attaches extra environment variables to the rubies it matches.
+//
+// Engine and Version are both optional; an empty rule matches every ruby.
+// Version is a VersionConstraint checked against the version in the ruby's
+// directory name, e.g. 9.4.8.0 for jruby-9.4.8.0.
+type EnvRule struct {
+	Engine  string            `json:"engine,omitempty"`
+	Version string            `json:"version,omitempty"`
+	Set     map[string]string `json:"set,omitempty"`
+	Prepend map[string]string `json:"prepend,omitempty"`
+	Unset   []string          `json:"unset,omitempty"`
+
+	// Separator joins prepended values, defaulting to the path list separator.
+	Separator string `json:"separator,omitempty"`
+}
+
+func (rule EnvRule) Matches(r *Ruby) (bool, error) {
+	if len(rule.Engine) > 0 && rule.Engine != r.Engine {
+		return false, nil
+	}
+	if len(rule.Version) > 0 {
+		constraint, err := ParseVersionConstraint(rule.Version)
+		if err != nil {
+			return false, err
+		}
+		return constraint.Matches(r.Version), nil
+	}
+	return true, nil
+}
+
+// envRulesKey records the changes made by env rules, so ResetRubyEnv can
+// undo them when switching rubies.
+const envRulesKey = "CHRB_ENV_RULES"
+
+type envRuleChange struct {
+	Key       string  `json:"key"`
+	Prepended string  `json:"prepended,omitempty"`
+	Separator string  `json:"separator,omitempty"`
+	Previous  *string `json:"previous"`
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// applyEnvRules applies every rule matching r to env, in order. Values may
+// reference other variables in env, e.g. $RUBY_ROOT.
+func (e *Env) applyEnvRules(rules []EnvRule, r *Ruby) error {
+	changes := []envRuleChange{}
+	record := func(key string) envRuleChange {
+		change := envRuleChange{Key: key}
+		if v, ok := e.LookupEnv(key); ok {
+			change.Previous = &v
+		}
+		return change
+	}
+
+	for _, rule := range rules {
+		matches, err := rule.Matches(r)
+		if err != nil {
+			return err
+		}
+		if !matches {
+			continue
+		}
+
+		for _, key := range sortedKeys(rule.Set) {
+			changes = append(changes, record(key))
+			e.Setenv(key, e.ExpandEnv(rule.Set[key]))
+		}
+
+		separator := rule.Separator
+		if len(separator) == 0 {
+			separator = string(filepath.ListSeparator)
+		}
+		for _, key := range sortedKeys(rule.Prepend) {
+			change := record(key)
+			change.Prepended = e.ExpandEnv(rule.Prepend[key])
+			change.Separator = separator
+			changes = append(changes, change)
+			if current, ok := e.LookupEnv(key); ok && len(current) > 0 {
+				e.Setenv(key, change.Prepended+separator+current)
+			} else {
+				e.Setenv(key, change.Prepended)
+			}
+		}
+
+		for _, key := range rule.Unset {
+			changes = append(changes, record(key))
+			e.Unsetenv(key)
+		}
+	}
+
+	if len(changes) == 0 {
+		return nil
+	}
+	encoded, err := json.Marshal(changes)
+	if err != nil {
+		return err
+	}
+	e.Setenv(envRulesKey, string(encoded))
+	return nil
+}
+
+// resetEnvRules undoes the changes recorded by applyEnvRules, newest first.
+// A record that can't be parsed is dropped, since there is nothing left to
+// undo it with.
+func (e *Env) resetEnvRules() {
+	encoded, ok := e.LookupEnv(envRulesKey)
+	if !ok {
+		return
+	}
+	e.Unsetenv(envRulesKey)
+
+	changes := []envRuleChange{}
+	if err := json.Unmarshal([]byte(encoded), &changes); err != nil {
+		return
+	}
+
+	for _, change := range slices.Backward(changes) {
+		if len(change.Prepended) == 0 {
+			if change.Previous != nil {
+				e.Setenv(change.Key, *change.Previous)
+			} else {
+				e.Unsetenv(change.Key)
+			}
+			continue
+		}
+
+		current, ok := e.LookupEnv(change.Key)
+		if !ok {
+			continue
+		}
+		entries := strings.Split(current, change.Separator)
+		for _, prepended := range strings.Split(change.Prepended, change.Separator) {
+			if i := slices.Index(entries, prepended); i >= 0 {
+				entries = slices.Delete(entries, i, i+1)
+			}
+		}
+		if len(entries) == 0 && change.Previous == nil {
+			e.Unsetenv(change.Key)
+		} else {
+			e.Setenv(change.Key, strings.Join(entries, change.Separator))
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package chrb_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/segiddins/chrb"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnvRules(t *testing.T) {
+	options := chrb.DefaultOptions.Clone()
+	options.EnvRules = []chrb.EnvRule{
+		{Engine: "ruby", Version: ">= 3.3", Set: map[string]string{"RUBY_YJIT_ENABLE": "1"}},
+		{Engine: "jruby", Set: map[string]string{"JRUBY_OPTS": "--dev"}, Prepend: map[string]string{"JAVA_OPTS": "-Xmx2g"}, Separator: " "},
+		{Engine: "truffleruby", Set: map[string]string{"TRUFFLERUBYOPT": "--jvm"}, Unset: []string{"JAVA_HOME"}},
+		{Prepend: map[string]string{"MANPATH": "$RUBY_ROOT/share/man"}},
+	}
+
+	original := []string{
+		"HOME=/Users/user",
+		"JAVA_HOME=/opt/java",
+		"JAVA_OPTS=-Dfile.encoding=UTF-8",
+		"MANPATH=/usr/share/man",
+		"PATH=/usr/bin",
+	}
+	config := &chrb.Config{
+		Fs:      afero.NewMemMapFs(),
+		Env:     chrb.ParseEnv(original),
+		Uid:     0,
+		Options: options,
+		RubyEnvFinder: func(r *chrb.Ruby) ([]string, error) {
+			return []string{"RUBY_ENGINE=" + r.Engine, "RUBY_VERSION=" + r.Version}, nil
+		},
+	}
+
+	tests := []struct {
+		dir  string
+		want map[string]*string
+	}{
+		{
+			dir: "/opt/rubies/ruby-3.3.6",
+			want: map[string]*string{
+				"RUBY_YJIT_ENABLE": pointer("1"),
+				"JRUBY_OPTS":       nil,
+				"MANPATH":          pointer("/opt/rubies/ruby-3.3.6/share/man:/usr/share/man"),
+			},
+		},
+		{
+			dir: "/opt/rubies/ruby-3.2.6",
+			want: map[string]*string{
+				"RUBY_YJIT_ENABLE": nil,
+				"MANPATH":          pointer("/opt/rubies/ruby-3.2.6/share/man:/usr/share/man"),
+			},
+		},
+		{
+			dir: "/opt/rubies/jruby-9.4.8.0",
+			want: map[string]*string{
+				"RUBY_YJIT_ENABLE": nil,
+				"JRUBY_OPTS":       pointer("--dev"),
+				"JAVA_OPTS":        pointer("-Xmx2g -Dfile.encoding=UTF-8"),
+				"JAVA_HOME":        pointer("/opt/java"),
+			},
+		},
+		{
+			dir: "/opt/rubies/truffleruby-24.0.0",
+			want: map[string]*string{
+				"JAVA_OPTS":      pointer("-Dfile.encoding=UTF-8"),
+				"TRUFFLERUBYOPT": pointer("--jvm"),
+				"JAVA_HOME":      nil,
+			},
+		},
+	}
+
+	// each ruby is activated on top of the previous one, so the rules of the
+	// previous ruby have to be undone first
+	for _, test := range tests {
+		t.Run(test.dir, func(t *testing.T) {
+			rubyDir := chrb.RubyDir(test.dir)
+			if err := afero.WriteFile(config.Fs, rubyDir.ExecPath(), []byte("ruby"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			ruby, err := chrb.RubyFromDir(config, rubyDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			env, err := ruby.Env(config)
+			if !assert.NoError(t, err) {
+				return
+			}
+			for key, want := range test.want {
+				got, ok := env.LookupEnv(key)
+				if want == nil {
+					assert.False(t, ok, key)
+				} else {
+					assert.Equal(t, *want, got, key)
+				}
+			}
+			config.Env = env
+		})
+	}
+
+	config.Env.ResetRubyEnv(config.Uid)
+	envList := config.Env.ToEnvList()
+	slices.Sort(envList)
+	assert.Equal(t, original, envList)
+}
@@ -0,0 +1,109 @@
+package chrb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/spf13/afero"
+)
+
+var ErrCommandNotFound = errors.New("command not found")
+
+// LookPath searches the PATH in e, rather than chrb's own PATH, for an
+// executable named file. Names containing a path separator are used as is.
+func (e *Env) LookPath(fs afero.Fs, file string) (string, error) {
+	if strings.ContainsRune(file, filepath.Separator) {
+		if isExecutable(fs, file) {
+			return file, nil
+		}
+		return "", fmt.Errorf("%s: %w", file, ErrCommandNotFound)
+	}
+
+	for _, dir := range filepath.SplitList(e.Getenv("PATH")) {
+		if len(dir) == 0 {
+			dir = "."
+		}
+		path := filepath.Join(dir, file)
+		if isExecutable(fs, path) {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("%s: %w", file, ErrCommandNotFound)
+}
+
+func isExecutable(fs afero.Fs, path string) bool {
+	stat, err := fs.Stat(path)
+	if err != nil || stat.IsDir() {
+		return false
+	}
+	return stat.Mode()&0o111 != 0
+}
+
+// forwardedSignals are passed on to a child started by RunCommand rather
+// than terminating chrb.
+var forwardedSignals = []os.Signal{syscall.SIGTERM, syscall.SIGHUP}
+
+// terminalSignals are sent by the terminal to its whole foreground process
+// group, so the child already gets them. RunCommand catches them so they
+// don't terminate chrb, but doesn't forward them, or the child would get
+// them twice. They're caught rather than ignored since an ignored signal
+// stays ignored in the child.
+var terminalSignals = []os.Signal{os.Interrupt, syscall.SIGQUIT}
+
+// RunCommand runs path as a child process with the given argv, forwarding
+// signals to it until it exits, and returns its exit status. A child killed
+// by a signal gets the shell convention of 128 plus the signal number.
+func RunCommand(ctx context.Context, path string, argv []string, env *Env) (int, error) {
+	cmd := exec.CommandContext(ctx, path)
+	cmd.Args = argv
+	cmd.Env = env.ToEnvList()
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, forwardedSignals...)
+	defer signal.Stop(signals)
+	ignored := make(chan os.Signal, 1)
+	signal.Notify(ignored, terminalSignals...)
+	defer signal.Stop(ignored)
+
+	if err := cmd.Start(); err != nil {
+		return 0, err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case sig := <-signals:
+				_ = cmd.Process.Signal(sig)
+			case <-ignored:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	err := cmd.Wait()
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return 0, err
+	}
+	return exitStatus(cmd.ProcessState), nil
+}
+
+func exitStatus(state *os.ProcessState) int {
+	if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+	return state.ExitCode()
+}
@@ -0,0 +1,85 @@
+package chrb_test
+
+import (
+	"bytes"
+	"context"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/segiddins/chrb"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnv_LookPath(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	assert.NoError(t, afero.WriteFile(fs, "/gem/bin/rake", []byte(""), 0755))
+	assert.NoError(t, afero.WriteFile(fs, "/ruby/bin/rake", []byte(""), 0755))
+	assert.NoError(t, afero.WriteFile(fs, "/ruby/bin/README", []byte(""), 0644))
+	assert.NoError(t, fs.MkdirAll("/ruby/bin/lib", 0755))
+
+	env := chrb.ParseEnv([]string{"PATH=/missing:/gem/bin:/ruby/bin"})
+
+	path, err := env.LookPath(fs, "rake")
+	assert.NoError(t, err)
+	assert.Equal(t, "/gem/bin/rake", path)
+
+	path, err = env.LookPath(fs, "/ruby/bin/rake")
+	assert.NoError(t, err)
+	assert.Equal(t, "/ruby/bin/rake", path)
+
+	for _, name := range []string{"rails", "README", "lib", "/ruby/bin/README"} {
+		_, err = env.LookPath(fs, name)
+		assert.ErrorIs(t, err, chrb.ErrCommandNotFound, name)
+	}
+}
+
+func TestRunCommand(t *testing.T) {
+	sh := shells["sh"]
+	if len(sh) == 0 {
+		t.Skip("sh not found")
+	}
+	env := chrb.ParseEnv([]string{"CHRB_TEST=3"})
+
+	tests := []struct {
+		script string
+		status int
+	}{
+		{script: "exit 0", status: 0},
+		{script: `exit "$CHRB_TEST"`, status: 3},
+		{script: `[ "$0" = "rake" ] || exit 1`, status: 0},
+		{script: "kill -TERM $$", status: 128 + 15},
+	}
+
+	for _, test := range tests {
+		t.Run(test.script, func(t *testing.T) {
+			status, err := chrb.RunCommand(context.Background(), sh, []string{"sh", "-c", test.script, "rake"}, env)
+			assert.NoError(t, err)
+			assert.Equal(t, test.status, status)
+		})
+	}
+}
+
+func TestCommandInProcessGroup(t *testing.T) {
+	sh := shells["sh"]
+	if runtime.GOOS == "windows" {
+		t.Skip("process groups are unix only")
+	}
+	if len(sh) == 0 {
+		t.Skip("sh not found")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	// the grandchild ignores SIGTERM and holds stdout open, so Run only
+	// returns early if the group gets killed after the grace period
+	cmd := chrb.CommandInProcessGroup(ctx, 300*time.Millisecond, sh, "-c", `sh -c 'trap "" TERM; sleep 30' & wait`)
+	cmd.Stdout = &bytes.Buffer{}
+
+	start := time.Now()
+	err := cmd.Run()
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), time.Second)
+}
@@ -0,0 +1,49 @@
+//go:build unix
+
+package chrb_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/segiddins/chrb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunCommand_Signals(t *testing.T) {
+	sh := shells["sh"]
+	if len(sh) == 0 {
+		t.Skip("sh not found")
+	}
+	dir := t.TempDir()
+	env := chrb.ParseEnv([]string{"CHRB_TEST_DIR=" + dir})
+
+	// the child records the signals it gets, and exits once it gets TERM
+	script := `trap 'echo INT >> "$CHRB_TEST_DIR/signals"' INT
+trap 'echo TERM >> "$CHRB_TEST_DIR/signals"; exit 3' TERM
+touch "$CHRB_TEST_DIR/started"
+while :; do sleep 0.01; done`
+
+	go func() {
+		assert.Eventually(t, func() bool {
+			_, err := os.Stat(filepath.Join(dir, "started"))
+			return err == nil
+		}, 5*time.Second, 10*time.Millisecond)
+		// the terminal would send SIGINT to the child itself, so it isn't
+		// forwarded, but it mustn't stop chrb either
+		assert.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGINT))
+		time.Sleep(100 * time.Millisecond)
+		assert.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGTERM))
+	}()
+
+	status, err := chrb.RunCommand(context.Background(), sh, []string{"sh", "-c", script}, env)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, status)
+	signals, err := os.ReadFile(filepath.Join(dir, "signals"))
+	assert.NoError(t, err)
+	assert.Equal(t, "TERM\n", string(signals))
+}
@@ -0,0 +1,80 @@
+package chrb
+
+import (
+	"os"
+	"strings"
+)
+
+// GemHomeScope describes how widely a GEM_HOME is shared, based on which
+// placeholders the GemHomeEnvPattern references.
+type GemHomeScope string
+
+const (
+	GemHomeScopeShared  GemHomeScope = "shared"
+	GemHomeScopeEngine  GemHomeScope = "engine"
+	GemHomeScopeApi     GemHomeScope = "api"
+	GemHomeScopeVersion GemHomeScope = "version"
+	GemHomeScopeProject GemHomeScope = "project"
+	GemHomeScopeGemset  GemHomeScope = "gemset"
+)
+
+// GemHome expands GemHomeEnvPattern for the ruby described by env.
+//
+// In addition to any variable in env, the pattern may reference
+// $RUBY_ENGINE, $RUBY_VERSION, $RUBY_API_VERSION, $PROJECT_ROOT and
+// $PROJECT_HASH. When the pattern is project scoped but there is no project,
+// the default pattern is used instead.
+func (o *Options) GemHome(env *Env, project *Project) (string, GemHomeScope) {
+	pattern := o.GemHomeEnvPattern
+	scope := gemHomeScope(pattern)
+	if scope == GemHomeScopeProject && project == nil {
+		pattern = DefaultOptions.GemHomeEnvPattern
+		scope = gemHomeScope(pattern)
+	}
+
+	gemHome := os.Expand(pattern, func(key string) string {
+		switch key {
+		case "RUBY_API_VERSION":
+			return rubyApiVersion(env)
+		case "PROJECT_ROOT":
+			return project.Root
+		case "PROJECT_HASH":
+			return project.Hash()
+		}
+		return env.Getenv(key)
+	})
+	return gemHome, scope
+}
+
+func gemHomeScope(pattern string) GemHomeScope {
+	keys := map[string]bool{}
+	os.Expand(pattern, func(key string) string {
+		keys[key] = true
+		return ""
+	})
+
+	switch {
+	case keys["PROJECT_ROOT"] || keys["PROJECT_HASH"]:
+		return GemHomeScopeProject
+	case keys["RUBY_VERSION"]:
+		return GemHomeScopeVersion
+	case keys["RUBY_API_VERSION"]:
+		return GemHomeScopeApi
+	case keys["RUBY_ENGINE"]:
+		return GemHomeScopeEngine
+	}
+	return GemHomeScopeShared
+}
+
+// rubyApiVersion returns RUBY_API_VERSION, falling back to deriving it from
+// RUBY_VERSION (3.3.6 -> 3.3.0) for rubies that don't report it.
+func rubyApiVersion(env *Env) string {
+	if v, ok := env.LookupEnv("RUBY_API_VERSION"); ok && len(v) > 0 {
+		return v
+	}
+	parts := strings.Split(env.Getenv("RUBY_VERSION"), ".")
+	if len(parts) < 2 {
+		return env.Getenv("RUBY_VERSION")
+	}
+	return parts[0] + "." + parts[1] + ".0"
+}
@@ -0,0 +1,53 @@
+package chrb_test
+
+import (
+	"testing"
+
+	"github.com/segiddins/chrb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOptions_GemHome(t *testing.T) {
+	env := chrb.ParseEnv([]string{
+		"HOME=/Users/user",
+		"RUBY_ENGINE=ruby",
+		"RUBY_VERSION=3.3.6",
+	})
+	project := &chrb.Project{Root: "/src/app", RubyVersion: "3.3.6"}
+
+	tests := []struct {
+		pattern string
+		env     *chrb.Env
+		project *chrb.Project
+		gemHome string
+		scope   chrb.GemHomeScope
+	}{
+		{pattern: "$HOME/.gem/$RUBY_ENGINE/$RUBY_VERSION", gemHome: "/Users/user/.gem/ruby/3.3.6", scope: chrb.GemHomeScopeVersion},
+		{pattern: "$HOME/.gem/$RUBY_ENGINE/$RUBY_API_VERSION", gemHome: "/Users/user/.gem/ruby/3.3.0", scope: chrb.GemHomeScopeApi},
+		{
+			pattern: "$HOME/.gem/$RUBY_ENGINE/$RUBY_API_VERSION",
+			env:     env.Merge([]string{"RUBY_API_VERSION=3.3.0+0"}),
+			gemHome: "/Users/user/.gem/ruby/3.3.0+0",
+			scope:   chrb.GemHomeScopeApi,
+		},
+		{pattern: "$HOME/.gem/$RUBY_ENGINE", gemHome: "/Users/user/.gem/ruby", scope: chrb.GemHomeScopeEngine},
+		{pattern: "/opt/gems", gemHome: "/opt/gems", scope: chrb.GemHomeScopeShared},
+		{pattern: "$PROJECT_ROOT/.gem/$RUBY_VERSION", project: project, gemHome: "/src/app/.gem/3.3.6", scope: chrb.GemHomeScopeProject},
+		{pattern: "$HOME/.gem/projects/${PROJECT_HASH}", project: project, gemHome: "/Users/user/.gem/projects/" + project.Hash(), scope: chrb.GemHomeScopeProject},
+		{pattern: "$PROJECT_ROOT/.gem", gemHome: "/Users/user/.gem/ruby/3.3.6", scope: chrb.GemHomeScopeVersion},
+	}
+
+	for _, test := range tests {
+		t.Run(test.pattern, func(t *testing.T) {
+			options := chrb.DefaultOptions.Clone()
+			options.GemHomeEnvPattern = test.pattern
+			e := test.env
+			if e == nil {
+				e = env
+			}
+			gemHome, scope := options.GemHome(e, test.project)
+			assert.Equal(t, test.gemHome, gemHome)
+			assert.Equal(t, test.scope, scope)
+		})
+	}
+}
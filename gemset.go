@@ -0,0 +1,119 @@
+package chrb
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+// gemsetProjectFile records which project a gemset belongs to, since the
+// gemset directory itself is named after a hash of the project root.
+const gemsetProjectFile = ".project"
+
+// Gemset is a per-project GEM_HOME that is layered in front of the shared
+// GEM_HOME, so projects can install conflicting gems without clobbering
+// each other's executables.
+type Gemset struct {
+	Name    string `json:"name"`
+	Dir     string `json:"dir"`
+	Project string `json:"project"`
+}
+
+func ProjectGemset(env *Env, options *Options, project *Project) Gemset {
+	name := project.Hash()
+	return Gemset{
+		Name:    name,
+		Dir:     filepath.Join(env.ExpandEnv(options.GemsetsEnvPattern), name),
+		Project: project.Root,
+	}
+}
+
+// GemHome returns the GEM_HOME inside the gemset for the ruby described by
+// env.
+func (g Gemset) GemHome(env *Env) string {
+	return filepath.Join(g.Dir, env.Getenv("RUBY_ENGINE"), env.Getenv("RUBY_VERSION"))
+}
+
+func (g Gemset) Create(config *Config) error {
+	if err := config.Fs.MkdirAll(g.Dir, 0755); err != nil {
+		return err
+	}
+	return afero.WriteFile(config.Fs, filepath.Join(g.Dir, gemsetProjectFile), []byte(g.Project+"\n"), 0644)
+}
+
+// CreateProjectGemset creates the gemset of the project containing
+// config.Dir, if it has one. Ruby.Env only computes the environment that
+// uses it, so this is left to the commands that activate a ruby.
+func CreateProjectGemset(config *Config) error {
+	project, err := config.Project()
+	if err != nil || project == nil || config.Uid == 0 {
+		return err
+	}
+	options := project.MergeOptions(config.Options)
+	if !options.GemsetEnabled() {
+		return nil
+	}
+	return ProjectGemset(config.Env, options, project).Create(config)
+}
+
+func (g Gemset) Remove(config *Config) error {
+	return config.Fs.RemoveAll(g.Dir)
+}
+
+// Rubies lists the engine-version pairs that have gems installed in the
+// gemset.
+func (g Gemset) Rubies(config *Config) ([]string, error) {
+	engines, err := afero.ReadDir(config.Fs, g.Dir)
+	if err != nil {
+		return nil, err
+	}
+	rubies := []string{}
+	for _, engine := range engines {
+		if !engine.IsDir() {
+			continue
+		}
+		versions, err := afero.ReadDir(config.Fs, filepath.Join(g.Dir, engine.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, version := range versions {
+			if version.IsDir() {
+				rubies = append(rubies, engine.Name()+"-"+version.Name())
+			}
+		}
+	}
+	return rubies, nil
+}
+
+func ListGemsets(config *Config) ([]Gemset, error) {
+	project, err := config.Project()
+	if err != nil {
+		return nil, err
+	}
+	dir := config.Env.ExpandEnv(project.MergeOptions(config.Options).GemsetsEnvPattern)
+	entries, err := afero.ReadDir(config.Fs, dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	gemsets := []Gemset{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		gemset := Gemset{Name: entry.Name(), Dir: filepath.Join(dir, entry.Name())}
+		content, err := afero.ReadFile(config.Fs, filepath.Join(gemset.Dir, gemsetProjectFile))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		gemset.Project = strings.TrimSpace(string(content))
+		gemsets = append(gemsets, gemset)
+	}
+	return gemsets, nil
+}
@@ -0,0 +1,130 @@
+package chrb_test
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/segiddins/chrb"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGemset(t *testing.T) {
+	config := &chrb.Config{
+		Fs:      afero.NewMemMapFs(),
+		Env:     chrb.ParseEnv([]string{"HOME=/Users/user", "PATH=/usr/bin"}),
+		Uid:     501,
+		Dir:     "/src/app/lib",
+		Options: chrb.DefaultOptions.Clone(),
+		RubyEnvFinder: func(r *chrb.Ruby) ([]string, error) {
+			return []string{
+				"RUBY_ENGINE=" + r.Engine,
+				"RUBY_VERSION=" + r.Version,
+				"GEM_ROOT=" + string(r.RubyDir) + "/lib/gems",
+			}, nil
+		},
+	}
+
+	rubyDir := chrb.RubyDir("/opt/rubies/ruby-3.3.6")
+	assert.NoError(t, afero.WriteFile(config.Fs, rubyDir.ExecPath(), []byte("ruby"), 0755))
+	assert.NoError(t, config.Fs.MkdirAll(config.Dir, 0755))
+	assert.NoError(t, afero.WriteFile(config.Fs, "/src/app/.ruby-version", []byte("3.3.6\n"), 0644))
+	assert.NoError(t, afero.WriteFile(config.Fs, "/src/app/.chrb.json", []byte(`{"gemset": true}`), 0644))
+
+	project, err := config.Project()
+	if !assert.NoError(t, err) || !assert.NotNil(t, project) {
+		return
+	}
+	assert.Equal(t, "/src/app", project.Root)
+	gemsetDir := filepath.Join("/Users/user/.gem/gemsets", project.Hash())
+
+	ruby, err := chrb.FindRuby(project.RubyVersion, config)
+	if !assert.NoError(t, err) {
+		return
+	}
+	env, err := ruby.Env(config)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, gemsetDir+"/ruby/3.3.6", env.Getenv("GEM_HOME"))
+	assert.Equal(t, gemsetDir+"/ruby/3.3.6:/Users/user/.gem/ruby/3.3.6:/opt/rubies/ruby-3.3.6/lib/gems", env.Getenv("GEM_PATH"))
+	assert.Equal(t, "/Users/user/.gem/ruby/3.3.6", env.Getenv("CHRB_GEM_HOME"))
+
+	// computing the environment leaves the disk alone
+	gemsets, err := chrb.ListGemsets(config)
+	if assert.NoError(t, err) {
+		assert.Empty(t, gemsets)
+	}
+	assert.NoError(t, chrb.CreateProjectGemset(config))
+
+	gemsets, err = chrb.ListGemsets(config)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []chrb.Gemset{{Name: project.Hash(), Dir: gemsetDir, Project: "/src/app"}}, gemsets)
+	}
+
+	env.ResetRubyEnv(config.Uid)
+	envList := env.ToEnvList()
+	slices.Sort(envList)
+	assert.Equal(t, []string{"HOME=/Users/user", "PATH=/usr/bin"}, envList)
+
+	assert.NoError(t, gemsets[0].Remove(config))
+	gemsets, err = chrb.ListGemsets(config)
+	if assert.NoError(t, err) {
+		assert.Empty(t, gemsets)
+	}
+}
+
+func TestOptions_Merge_Gemset(t *testing.T) {
+	enabled, disabled := true, false
+
+	options := chrb.DefaultOptions.Clone()
+	assert.False(t, options.GemsetEnabled())
+
+	options.Merge(&chrb.Options{Gemset: &enabled})
+	assert.True(t, options.GemsetEnabled())
+
+	// a project that doesn't mention gemsets keeps the user's choice
+	options.Merge(&chrb.Options{})
+	assert.True(t, options.GemsetEnabled())
+
+	options.Merge(&chrb.Options{Gemset: &disabled})
+	assert.False(t, options.GemsetEnabled())
+	assert.True(t, enabled)
+}
+
+func TestGemset_ProjectPattern(t *testing.T) {
+	config := &chrb.Config{
+		Fs:      afero.NewMemMapFs(),
+		Env:     chrb.ParseEnv([]string{"HOME=/Users/user", "PATH=/usr/bin"}),
+		Uid:     501,
+		Dir:     "/src/app",
+		Options: chrb.DefaultOptions.Clone(),
+		RubyEnvFinder: func(r *chrb.Ruby) ([]string, error) {
+			return []string{"RUBY_ENGINE=" + r.Engine, "RUBY_VERSION=" + r.Version}, nil
+		},
+	}
+	rubyDir := chrb.RubyDir("/opt/rubies/ruby-3.3.6")
+	assert.NoError(t, afero.WriteFile(config.Fs, rubyDir.ExecPath(), []byte("ruby"), 0755))
+	assert.NoError(t, afero.WriteFile(config.Fs, "/src/app/.ruby-version", []byte("3.3.6\n"), 0644))
+	assert.NoError(t, afero.WriteFile(config.Fs, "/src/app/.chrb.json", []byte(`{"gemset": true, "gemsets_env_pattern": "$HOME/gemsets"}`), 0644))
+
+	project, err := config.Project()
+	if !assert.NoError(t, err) {
+		return
+	}
+	gemsetDir := filepath.Join("/Users/user/gemsets", project.Hash())
+
+	env, err := (&chrb.Ruby{Engine: "ruby", Version: "3.3.6", RubyDir: rubyDir}).Env(config)
+	if assert.NoError(t, err) {
+		assert.Equal(t, gemsetDir+"/ruby/3.3.6", env.Getenv("GEM_HOME"))
+	}
+	assert.NoError(t, chrb.CreateProjectGemset(config))
+
+	// the gemset is listed from where the project's options put it
+	gemsets, err := chrb.ListGemsets(config)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []chrb.Gemset{{Name: project.Hash(), Dir: gemsetDir, Project: "/src/app"}}, gemsets)
+	}
+}
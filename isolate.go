@@ -0,0 +1,203 @@
+package chrb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// IsolationStrategy is how a matrix run gets its own working directory.
+type IsolationStrategy string
+
+const (
+	// IsolateCopy copies the directory, using copy-on-write clones where
+	// the filesystem supports them. Uncommitted and ignored files, like an
+	// installed bundle, come along.
+	IsolateCopy IsolationStrategy = "copy"
+	// IsolateWorktree checks out HEAD of the directory's git repository
+	// in a new worktree, which is cheaper for large repositories but only
+	// has committed files.
+	IsolateWorktree IsolationStrategy = "worktree"
+)
+
+func ParseIsolationStrategy(s string) (IsolationStrategy, error) {
+	switch strategy := IsolationStrategy(s); strategy {
+	case IsolateCopy, IsolateWorktree:
+		return strategy, nil
+	}
+	return "", fmt.Errorf("invalid isolation strategy: %q, expected copy or worktree", s)
+}
+
+// Isolation is a private checkout of a working directory.
+type Isolation struct {
+	Strategy IsolationStrategy
+	// Root is what was created, and Dir is where to run in it, which is
+	// below Root when isolating a subdirectory of a git repository.
+	Root string
+	Dir  string
+	// source is the directory that Root is a checkout of.
+	source string
+	// repo is the repository a worktree was added to.
+	repo string
+}
+
+// Isolate makes a private checkout of dir at root, which must not exist.
+// Paths in excludes are left out of a copy, such as a log directory inside
+// dir that's being written to while other checkouts are made.
+func Isolate(ctx context.Context, strategy IsolationStrategy, dir, root string, excludes ...string) (*Isolation, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Lstat(root); err == nil {
+		return nil, fmt.Errorf("isolating %s: %s already exists", dir, root)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	isolation := &Isolation{Strategy: strategy, Root: root, Dir: root, source: dir}
+
+	switch strategy {
+	case IsolateCopy:
+		if err := copyTree(ctx, dir, root, excludes); err != nil {
+			return nil, err
+		}
+	case IsolateWorktree:
+		toplevel, err := git(ctx, dir, "rev-parse", "--show-toplevel")
+		if err != nil {
+			return nil, err
+		}
+		prefix, err := git(ctx, dir, "rev-parse", "--show-prefix")
+		if err != nil {
+			return nil, err
+		}
+		if _, err := git(ctx, toplevel, "worktree", "add", "--detach", root, "HEAD"); err != nil {
+			return nil, err
+		}
+		isolation.repo = toplevel
+		isolation.source = toplevel
+		isolation.Dir = filepath.Join(root, prefix)
+	default:
+		return nil, fmt.Errorf("invalid isolation strategy: %q", strategy)
+	}
+	return isolation, nil
+}
+
+// Rebase maps a path inside the original directory to the same path in the
+// checkout, leaving other paths alone.
+func (i *Isolation) Rebase(path string) string {
+	rel, err := filepath.Rel(i.source, path)
+	if err != nil || !filepath.IsAbs(path) || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return path
+	}
+	return filepath.Join(i.Root, rel)
+}
+
+// RebaseEnv points the bundler settings and PATH entries in env that refer
+// to the original directory, such as a project's Gemfile or binstubs, at
+// the checkout instead.
+func (i *Isolation) RebaseEnv(env *Env) {
+	for _, key := range []string{"BUNDLE_GEMFILE", "BUNDLE_PATH", "BUNDLE_APP_CONFIG"} {
+		if value, ok := env.LookupEnv(key); ok {
+			env.Setenv(key, i.Rebase(value))
+		}
+	}
+	if path, ok := env.LookupEnv("PATH"); ok {
+		entries := filepath.SplitList(path)
+		for j, entry := range entries {
+			entries[j] = i.Rebase(entry)
+		}
+		env.Setenv("PATH", strings.Join(entries, string(os.PathListSeparator)))
+	}
+}
+
+// Remove deletes the checkout, unregistering it from git for a worktree.
+func (i *Isolation) Remove() error {
+	if i.Strategy == IsolateWorktree {
+		_, err := git(context.Background(), i.repo, "worktree", "remove", "--force", i.Root)
+		return err
+	}
+	return os.RemoveAll(i.Root)
+}
+
+// copyTree copies src to dst without the paths in excludes, copying whole
+// directories at once unless they contain one.
+func copyTree(ctx context.Context, src, dst string, excludes []string) error {
+	inside := false
+	for _, exclude := range excludes {
+		if exclude == src {
+			return nil
+		}
+		if rel, err := filepath.Rel(src, exclude); err == nil && filepath.IsLocal(rel) {
+			inside = true
+		}
+	}
+	if !inside {
+		return copyPath(ctx, src, dst)
+	}
+
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if err := os.Mkdir(dst, info.Mode().Perm()); err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := copyTree(ctx, filepath.Join(src, entry.Name()), filepath.Join(dst, entry.Name()), excludes); err != nil {
+			os.RemoveAll(dst)
+			return err
+		}
+	}
+	return nil
+}
+
+func copyPath(ctx context.Context, src, dst string) error {
+	var args [][]string
+	switch runtime.GOOS {
+	case "linux":
+		args = [][]string{{"-a", "--reflink=auto"}}
+	case "darwin":
+		// clonefile only works within an APFS volume, so fall back to a
+		// plain copy when it fails
+		args = [][]string{{"-c", "-R", "-p"}, {"-R", "-p"}}
+	case "windows":
+		return fmt.Errorf("copy isolation is not supported on windows")
+	default:
+		args = [][]string{{"-R", "-p"}}
+	}
+
+	var err error
+	for _, flags := range args {
+		cmd := exec.CommandContext(ctx, "cp", append(flags, src, dst)...)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		if err = cmd.Run(); err == nil {
+			return nil
+		}
+		err = fmt.Errorf("copying %s: %w: %s", src, err, strings.TrimSpace(stderr.String()))
+		os.RemoveAll(dst)
+	}
+	return err
+}
+
+func git(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
@@ -0,0 +1,106 @@
+package chrb_test
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/segiddins/chrb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsolate(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("copy isolation is not supported on windows")
+	}
+	t.Setenv("PATH", testPath)
+	src := filepath.Join(t.TempDir(), "app")
+	assert.NoError(t, os.MkdirAll(filepath.Join(src, "lib"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "Gemfile"), []byte("source 'https://rubygems.org'\n"), 0644))
+
+	root := filepath.Join(t.TempDir(), "3.3")
+	isolation, err := chrb.Isolate(context.Background(), chrb.IsolateCopy, src, root)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, root, isolation.Dir)
+	assert.FileExists(t, filepath.Join(root, "Gemfile"))
+	assert.DirExists(t, filepath.Join(root, "lib"))
+
+	env := chrb.ParseEnv([]string{
+		"BUNDLE_GEMFILE=" + filepath.Join(src, "Gemfile"),
+		"PATH=" + filepath.Join(src, "bin") + ":/usr/bin",
+		"HOME=" + src,
+	})
+	isolation.RebaseEnv(env)
+	assert.Equal(t, filepath.Join(root, "Gemfile"), env.Getenv("BUNDLE_GEMFILE"))
+	assert.Equal(t, filepath.Join(root, "bin")+":/usr/bin", env.Getenv("PATH"))
+	assert.Equal(t, src, env.Getenv("HOME"))
+	assert.Equal(t, src+"-other", isolation.Rebase(src+"-other"))
+
+	assert.NoError(t, isolation.Remove())
+	assert.NoDirExists(t, root)
+	assert.FileExists(t, filepath.Join(src, "Gemfile"))
+
+	_, err = chrb.Isolate(context.Background(), chrb.IsolateCopy, src, filepath.Join(src, "lib"))
+	assert.ErrorContains(t, err, "already exists")
+}
+
+func TestIsolate_Excludes(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("copy isolation is not supported on windows")
+	}
+	t.Setenv("PATH", testPath)
+	src := filepath.Join(t.TempDir(), "app")
+	for _, path := range []string{"Gemfile", "lib/app.rb", "tmp/cache/a", "tmp/logs/3.3.log"} {
+		assert.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(src, path)), 0755))
+		assert.NoError(t, os.WriteFile(filepath.Join(src, path), nil, 0644))
+	}
+
+	root := filepath.Join(t.TempDir(), "3.3")
+	isolation, err := chrb.Isolate(context.Background(), chrb.IsolateCopy, src, root, filepath.Join(src, "tmp", "logs"), "/elsewhere")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.FileExists(t, filepath.Join(root, "Gemfile"))
+	assert.FileExists(t, filepath.Join(root, "lib", "app.rb"))
+	assert.FileExists(t, filepath.Join(root, "tmp", "cache", "a"))
+	assert.NoDirExists(t, filepath.Join(root, "tmp", "logs"))
+	assert.NoError(t, isolation.Remove())
+}
+
+func TestIsolate_Worktree(t *testing.T) {
+	t.Setenv("PATH", testPath)
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	repo := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(repo, "sub"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(repo, "sub", "a.rb"), nil, 0644))
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "-A"},
+		{"-c", "user.name=chrb", "-c", "user.email=chrb@example.com", "commit", "-q", "-m", "init"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repo
+		out, err := cmd.CombinedOutput()
+		if !assert.NoError(t, err, string(out)) {
+			return
+		}
+	}
+
+	root := filepath.Join(t.TempDir(), "3.3")
+	isolation, err := chrb.Isolate(context.Background(), chrb.IsolateWorktree, filepath.Join(repo, "sub"), root)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, filepath.Join(root, "sub"), filepath.Clean(isolation.Dir))
+	assert.FileExists(t, filepath.Join(root, "sub", "a.rb"))
+
+	assert.NoError(t, isolation.Remove())
+	assert.NoDirExists(t, root)
+}
@@ -0,0 +1,769 @@
+package chrb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/jedib0t/go-pretty/v6/progress"
+	"github.com/urfave/cli/v3"
+	"golang.org/x/term"
+)
+
+var (
+	errInterrupted = errors.New("interrupted")
+	errFailFast    = errors.New("canceled after another run failed")
+	errTimedOut    = errors.New("timed out")
+)
+
+// runAttempt is a single execution of the command, of which there are
+// several when a failing run is retried.
+type runAttempt struct {
+	stdout string
+	status int
+	exit   string
+	time   time.Duration
+	usage  ResourceUsage
+	err    error
+	// stopped is set when the run was cut short by the matrix being
+	// canceled, rather than by its own timeout or exiting on its own
+	stopped bool
+	// install is set for a failed bundle install, run before the command
+	install bool
+}
+
+func (a *runAttempt) String() string {
+	return fmt.Sprintf("%s in %s", a.exit, a.time.Round(time.Millisecond))
+}
+
+func (a *runAttempt) report() MatrixAttempt {
+	return MatrixAttempt{
+		Status:   a.status,
+		Exit:     a.exit,
+		Duration: a.time,
+		Usage:    a.usage,
+		Output:   a.stdout,
+		Install:  a.install,
+	}
+}
+
+// runResult describes the run for one ruby. Its stdout, exit and err come
+// from the last attempt, while time covers all of them.
+type runResult struct {
+	pattern  string
+	ruby     *Ruby
+	stdout   string
+	exit     string
+	time     time.Duration
+	err      error
+	axes     []MatrixAxisValue
+	attempts []runAttempt
+	running  bool
+	canceled bool
+}
+
+func (r *runResult) String() string {
+	if r.canceled && r.time == 0 {
+		return fmt.Sprintf("%s (%s %s) canceled", r.pattern, r.ruby.Engine, r.ruby.Version)
+	}
+	if r.running {
+		if len(r.attempts) > 0 {
+			return fmt.Sprintf("%s (%s %s) running attempt %d", r.pattern, r.ruby.Engine, r.ruby.Version, len(r.attempts)+1)
+		}
+		return fmt.Sprintf("%s (%s %s) running", r.pattern, r.ruby.Engine, r.ruby.Version)
+	}
+	if r.time > 0 {
+		if len(r.attempts) > 1 {
+			return fmt.Sprintf("%s (%s %s) -> %s in %s after %d attempts", r.pattern, r.ruby.Engine, r.ruby.Version, r.exit, r.time.Round(time.Millisecond), len(r.attempts))
+		}
+		return fmt.Sprintf("%s (%s %s) -> %s in %s", r.pattern, r.ruby.Engine, r.ruby.Version, r.exit, r.time.Round(time.Millisecond))
+	}
+	return fmt.Sprintf("%s (%s %s) queued", r.pattern, r.ruby.Engine, r.ruby.Version)
+}
+
+func (r *runResult) report() MatrixResult {
+	result := MatrixResult{
+		Pattern:  r.pattern,
+		Engine:   r.ruby.Engine,
+		Version:  r.ruby.Version,
+		RubyDir:  r.ruby.RubyDir,
+		Status:   -1,
+		Duration: r.time,
+		Output:   r.stdout,
+		Canceled: r.canceled,
+		Axes:     r.axes,
+		Attempts: []MatrixAttempt{},
+	}
+	if r.err != nil {
+		result.Error = r.err.Error()
+	}
+	for _, attempt := range r.attempts {
+		result.Status = attempt.status
+		result.Usage = result.Usage.add(attempt.usage)
+		result.Attempts = append(result.Attempts, attempt.report())
+	}
+	return result
+}
+
+// parseReports splits --report values of the form format=path, where a path
+// of - is the terminal.
+func parseReports(values []string) ([][2]string, error) {
+	reports := [][2]string{}
+	for _, value := range values {
+		format, path, ok := strings.Cut(value, "=")
+		if !ok || len(path) == 0 {
+			return nil, fmt.Errorf("invalid report %q, expected format=path", value)
+		}
+		if !slices.Contains(ReportFormats, format) {
+			return nil, fmt.Errorf("invalid report format %q, expected one of %s", format, strings.Join(ReportFormats, ", "))
+		}
+		reports = append(reports, [2]string{format, path})
+	}
+	return reports, nil
+}
+
+func writeReports(config *Config, cmd *cli.Command, reports [][2]string, report *MatrixReport) error {
+	for _, r := range reports {
+		format, path := r[0], r[1]
+		if path == "-" {
+			if err := report.Write(cmd.Writer, format); err != nil {
+				return err
+			}
+			continue
+		}
+
+		f, err := config.Fs.Create(path)
+		if err != nil {
+			return err
+		}
+		if err := report.Write(f, format); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// matrixEntry is a cell of the matrix to run the command in, and its
+// environment. The pattern labels it in progress, output and reports.
+type matrixEntry struct {
+	pattern string
+	ruby    *Ruby
+	axes    []MatrixAxisValue
+	env     []string
+	ops     []EnvOp
+}
+
+// rejoinConstraints undoes the slice flag splitting the comma separated
+// requirements of a constraint, as in --ruby 'ruby >= 3.1, < 3.4', while
+// keeping --ruby 3.2,3.3 as two selectors.
+func rejoinConstraints(values []string) []string {
+	joined := []string{}
+	for _, value := range values {
+		trimmed := strings.TrimSpace(value)
+		if len(joined) > 0 && len(trimmed) > 0 && strings.ContainsAny(trimmed[:1], "=!<>~") {
+			joined[len(joined)-1] += ", " + trimmed
+			continue
+		}
+		joined = append(joined, value)
+	}
+	return joined
+}
+
+// matrixEntries expands the --ruby selectors into the rubies to run on, in
+// order and without duplicates, crossed with the axes of the matrix file
+// when there is one. A ruby selected by a plain pattern is labelled with it,
+// and the rest by their directory name, followed by any axis values. Labels
+// name log files and rows of the summary, so they must be unique.
+func matrixEntries(config *Config, file *MatrixFile, selectors, excludes []string, latestPerMinor bool) ([]matrixEntry, error) {
+	rubies := []Ruby{}
+	labels := map[RubyDir]string{}
+	for _, selector := range selectors {
+		parsed, err := parseRubySelector(config, selector)
+		if err != nil {
+			return nil, err
+		}
+		selected, err := SelectRubies(config, selector)
+		if err != nil {
+			return nil, err
+		}
+		for _, ruby := range selected {
+			if _, ok := labels[ruby.RubyDir]; ok {
+				continue
+			}
+			labels[ruby.RubyDir] = filepath.Base(string(ruby.RubyDir))
+			if len(parsed.pattern) > 0 {
+				labels[ruby.RubyDir] = parsed.pattern
+			}
+			rubies = append(rubies, ruby)
+		}
+	}
+
+	rubies, err := ExcludeRubies(config, rubies, excludes)
+	if err != nil {
+		return nil, err
+	}
+	if latestPerMinor {
+		rubies = LatestPerMinor(rubies)
+	}
+	if len(rubies) == 0 {
+		return nil, fmt.Errorf("every selected ruby was excluded")
+	}
+
+	cells := []MatrixCell{}
+	if file != nil {
+		if cells, err = file.Cells(config, rubies); err != nil {
+			return nil, err
+		}
+		if len(cells) == 0 {
+			return nil, fmt.Errorf("every cell of the matrix was excluded")
+		}
+	} else {
+		for _, ruby := range rubies {
+			cells = append(cells, MatrixCell{Ruby: ruby})
+		}
+	}
+
+	envs := map[RubyDir]*Env{}
+	fileNames := map[string]string{}
+	entries := []matrixEntry{}
+	for _, cell := range cells {
+		rubyEnv, ok := envs[cell.Ruby.RubyDir]
+		if !ok {
+			if rubyEnv, err = cell.Ruby.Env(config); err != nil {
+				return nil, err
+			}
+			envs[cell.Ruby.RubyDir] = rubyEnv
+		}
+		env := rubyEnv.Clone()
+		if file != nil {
+			file.Apply(env, cell)
+		}
+
+		label := []string{labels[cell.Ruby.RubyDir]}
+		for _, value := range cell.Axes {
+			label = append(label, value.String())
+		}
+		pattern := strings.Join(label, " ")
+		if other, ok := fileNames[SafeFileName(pattern)]; ok {
+			if other == pattern {
+				return nil, fmt.Errorf("more than one cell is labelled %q", pattern)
+			}
+			return nil, fmt.Errorf("cells %q and %q would share a log file", other, pattern)
+		}
+		fileNames[SafeFileName(pattern)] = pattern
+		entries = append(entries, matrixEntry{
+			pattern: pattern,
+			ruby:    &cell.Ruby,
+			axes:    cell.Axes,
+			env:     env.ToEnvList(),
+			ops:     env.Ops(config.Env),
+		})
+	}
+	return entries, nil
+}
+
+func resourceLimits(cmd *cli.Command) (ResourceLimits, error) {
+	limits := ResourceLimits{
+		CPU:   cmd.Duration("limit-cpu"),
+		Files: cmd.Int("limit-files"),
+	}
+	if memory := cmd.String("limit-memory"); len(memory) > 0 {
+		var err error
+		if limits.Memory, err = ParseByteSize(memory); err != nil {
+			return limits, err
+		}
+	}
+	if limits.CPU < 0 || limits.Files < 0 {
+		return limits, fmt.Errorf("resource limits must be positive")
+	}
+	if !limits.IsZero() && runtime.GOOS == "windows" {
+		return limits, fmt.Errorf("resource limits are not supported on windows")
+	}
+	if limits.Memory > 0 && runtime.GOOS == "darwin" {
+		return limits, fmt.Errorf("--limit-memory is not supported on macOS, which doesn't enforce it")
+	}
+	return limits, nil
+}
+
+// runOnce runs the command, stopping it if it takes longer than timeout. Its
+// output is captured, and also copied as it arrives to stream and log when
+// they are set.
+func runOnce(ctx context.Context, dir string, env []string, args []string, limits ResourceLimits, timeout, grace time.Duration, stream *LineStream, log *RunLog) runAttempt {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, timeout, errTimedOut)
+		defer cancel()
+	}
+
+	cmd := CommandInProcessGroup(ctx, grace, "env", limits.wrap(args)...)
+	stopped := false
+	stop := cmd.Cancel
+	cmd.Cancel = func() error {
+		stopped = true
+		return stop()
+	}
+	cmd.Env = env
+	cmd.Dir = dir
+	stdout := bytes.NewBuffer(nil)
+	outputs := []io.Writer{stdout}
+	if stream != nil {
+		outputs = append(outputs, stream)
+		defer stream.Flush()
+	}
+	if log != nil {
+		outputs = append(outputs, log.file)
+	}
+	cmd.Stdout = io.MultiWriter(outputs...)
+	cmd.Stderr = cmd.Stdout
+	if log != nil && log.stdout != nil {
+		combined := &lockedWriter{w: cmd.Stdout}
+		cmd.Stdout = io.MultiWriter(combined, log.stdout)
+		cmd.Stderr = io.MultiWriter(combined, log.stderr)
+	}
+
+	start := time.Now()
+	err := cmd.Run()
+	attempt := runAttempt{
+		stdout: stdout.String(),
+		status: -1,
+		exit:   cmd.ProcessState.String(),
+		time:   time.Since(start),
+		usage:  resourceUsage(cmd.ProcessState),
+		err:    err,
+	}
+	if cmd.ProcessState != nil {
+		attempt.status = exitStatus(cmd.ProcessState)
+	}
+	if stopped && errors.Is(context.Cause(ctx), errTimedOut) {
+		attempt.exit = fmt.Sprintf("timed out after %s", timeout)
+		attempt.err = errors.New(attempt.exit)
+	} else if stopped {
+		attempt.stopped = true
+	}
+	return attempt
+}
+
+func execMatrix(ctx context.Context, cmd *cli.Command) error {
+	rubies := cmd.StringSlice("ruby")
+	jobs := cmd.Int("jobs")
+	if jobs < 1 {
+		return fmt.Errorf("invalid number of jobs: %d", jobs)
+	}
+	failFast := cmd.Bool("fail-fast")
+	grace := cmd.Duration("grace-period")
+	timeout := cmd.Duration("timeout")
+	retries := cmd.Int("retries")
+	if retries < 0 {
+		return fmt.Errorf("invalid number of retries: %d", retries)
+	}
+	reports, err := parseReports(cmd.StringSlice("report"))
+	if err != nil {
+		return err
+	}
+
+	limits, err := resourceLimits(cmd)
+	if err != nil {
+		return err
+	}
+	summaryOnly := cmd.Bool("summary-only")
+	keep := cmd.Bool("keep")
+	isolateWith, err := ParseIsolationStrategy(cmd.String("isolate-with"))
+	if err != nil {
+		return err
+	}
+	logDir := cmd.String("log-dir")
+	splitLogs := cmd.Bool("split-logs")
+
+	config := GetConfig(ctx)
+
+	arg := commandArgs(ctx, cmd)
+
+	// the matrix file is only implied when the command line doesn't say
+	// everything to run
+	var file *MatrixFile
+	if path := cmd.String("file"); len(path) > 0 || len(rubies) == 0 || len(arg) == 0 {
+		if file, err = loadMatrixFile(config, path); err != nil {
+			return err
+		}
+	}
+	if gemfiles := cmd.StringSlice("gemfile"); len(gemfiles) > 0 {
+		if file == nil {
+			file = &MatrixFile{Dir: config.Dir}
+		}
+		values, err := GlobGemfiles(config.Fs, file.Dir, gemfiles)
+		if err != nil {
+			return err
+		}
+		file.SetAxis(MatrixAxis{Name: "gemfile", Values: values})
+	}
+	bundleInstall := cmd.Bool("bundle-install")
+	if file != nil {
+		if len(rubies) == 0 {
+			rubies = file.Rubies
+		}
+		if len(arg) == 0 {
+			arg = file.Command
+		}
+		bundleInstall = bundleInstall || file.BundleInstall
+	}
+	if len(rubies) == 0 {
+		return fmt.Errorf("no rubies to run on, pass --ruby or list them in %s", MatrixFileName)
+	}
+	if len(arg) == 0 {
+		return fmt.Errorf("no command to run, pass one or set it in %s", MatrixFileName)
+	}
+
+	excludes := rejoinConstraints(cmd.StringSlice("exclude"))
+	entries, err := matrixEntries(config, file, rejoinConstraints(rubies), excludes, cmd.Bool("latest-per-minor"))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(cmd.Writer, "running %d cells:\n", len(entries))
+	for _, entry := range entries {
+		fmt.Fprintf(cmd.Writer, "  %s (%s %s) %s\n", entry.pattern, entry.ruby.Engine, entry.ruby.Version, entry.ruby.RubyDir)
+	}
+
+	isolateRoot := ""
+	isolateExcludes := []string{}
+	if cmd.Bool("isolate") {
+		if len(config.Dir) == 0 {
+			return fmt.Errorf("isolate needs a working directory")
+		}
+		// the logs of other cells would be copied half written
+		if len(logDir) > 0 {
+			abs, err := filepath.Abs(logDir)
+			if err != nil {
+				return err
+			}
+			isolateExcludes = append(isolateExcludes, abs)
+		}
+		if isolateRoot, err = os.MkdirTemp("", "chrb-matrix-"); err != nil {
+			return err
+		}
+		if keep {
+			defer fmt.Fprintf(cmd.Writer, "kept isolated working directories in %s\n", isolateRoot)
+		} else {
+			defer os.RemoveAll(isolateRoot)
+		}
+	}
+
+	if len(logDir) > 0 {
+		if err := config.Fs.MkdirAll(logDir, 0755); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	go func() {
+		select {
+		case <-signals:
+			fmt.Fprintln(cmd.Writer, "Interrupted")
+			cancel(errInterrupted)
+		case <-ctx.Done():
+		}
+	}()
+
+	pw := progress.NewWriter()
+	pw.SetAutoStop(true)
+	pw.SetOutputWriter(cmd.Writer)
+	pw.SetNumTrackersExpected(len(entries))
+	style := progress.StyleDefault
+	style.Visibility.TrackerOverall = false
+	style.Visibility.ETA = false
+	style.Visibility.ETAOverall = false
+	style.Visibility.Percentage = false
+	style.Visibility.Value = false
+	style.Options.TimeDonePrecision = time.Millisecond
+	pw.SetStyle(style)
+	// the progress display would be scrolled away by streamed lines
+	var streams []*LineStream
+	if cmd.Bool("stream") {
+		_, tty := terminalFd(cmd.Writer)
+		color := tty && len(config.Env.Getenv("NO_COLOR")) == 0
+		labels := []string{}
+		for _, entry := range entries {
+			labels = append(labels, entry.pattern)
+		}
+		streams = NewLineStreams(cmd.Writer, labels, color)
+	}
+	rendered := make(chan struct{})
+	go func() {
+		if streams == nil {
+			pw.Render()
+		}
+		close(rendered)
+	}()
+
+	results := make(chan runResult)
+	// the cells' deferred progress updates are waited for, so the last
+	// frame is rendered before the results are printed
+	var cells sync.WaitGroup
+	slots := make(chan struct{}, jobs)
+	var running, queued atomic.Int64
+	queued.Store(int64(len(entries)))
+	updateCounts := func() {
+		pw.SetPinnedMessages(fmt.Sprintf("%d running, %d queued", running.Load(), queued.Load()))
+	}
+	updateCounts()
+
+	for i, entry := range entries {
+		pattern := entry.pattern
+		var stream *LineStream
+		if streams != nil {
+			stream = streams[i]
+		}
+		tracker := &progress.Tracker{
+			Message: pattern,
+			Total:   0,
+		}
+		pw.AppendTracker(tracker)
+		cells.Add(1)
+		go func() {
+			defer cells.Done()
+			result := &runResult{pattern: pattern, ruby: entry.ruby, axes: entry.axes}
+			tracker.UpdateMessage(result.String())
+			defer func() {
+				tracker.UpdateMessage(result.String())
+				if result.err != nil {
+					tracker.MarkAsErrored()
+				} else {
+					tracker.MarkAsDone()
+				}
+			}()
+
+			select {
+			case slots <- struct{}{}:
+				// canceled before the slot is freed, so a queued cell
+				// can't start in its place
+				defer func() {
+					if failFast && result.err != nil && !result.canceled {
+						cancel(errFailFast)
+					}
+					<-slots
+				}()
+			case <-ctx.Done():
+			}
+			if ctx.Err() != nil {
+				queued.Add(-1)
+				updateCounts()
+				result.canceled = true
+				result.err = context.Cause(ctx)
+				results <- *result
+				return
+			}
+			queued.Add(-1)
+			running.Add(1)
+			updateCounts()
+			defer func() {
+				running.Add(-1)
+				updateCounts()
+			}()
+			result.running = true
+			tracker.UpdateMessage(result.String())
+
+			var log *RunLog
+			if len(logDir) > 0 {
+				var err error
+				log, err = OpenRunLog(config.Fs, logDir, pattern, splitLogs)
+				if err == nil {
+					err = log.WriteHeader(arg, entry.ruby, entry.ops, time.Now())
+				}
+				if err != nil {
+					if log != nil {
+						log.Close()
+					}
+					result.running = false
+					result.err = err
+					results <- *result
+					return
+				}
+				defer log.Close()
+			}
+
+			workDir, env := "", entry.env
+			var isolation *Isolation
+			if isolateRoot != "" {
+				var err error
+				// numbered, so no two cells can be given the same directory
+				root := filepath.Join(isolateRoot, fmt.Sprintf("%d-%s", i, SafeFileName(pattern)))
+				isolation, err = Isolate(ctx, isolateWith, config.Dir, root, isolateExcludes...)
+				if err != nil {
+					result.running = false
+					result.err = err
+					results <- *result
+					return
+				}
+				workDir = isolation.Dir
+				isolatedEnv := ParseEnv(env)
+				isolation.RebaseEnv(isolatedEnv)
+				env = isolatedEnv.ToEnvList()
+			}
+
+			// a log that can't be written fails a run that otherwise passed
+			var logErr error
+			writeAttempt := func(attempt *runAttempt) {
+				if log == nil || logErr != nil {
+					return
+				}
+				if err := log.WriteAttempt(len(result.attempts), attempt.report()); err != nil {
+					logErr = fmt.Errorf("writing log: %w", err)
+				}
+			}
+
+			installed := true
+			if bundleInstall {
+				install := runOnce(ctx, workDir, env, []string{"bundle", "install"}, limits, timeout, grace, stream, log)
+				if install.err != nil {
+					installed = false
+					install.install = true
+					install.exit = "bundle install " + install.exit
+					install.err = fmt.Errorf("bundle install: %w", install.err)
+					result.attempts = append(result.attempts, install)
+					result.stdout = install.stdout
+					result.exit = install.exit
+					result.time = install.time
+					result.err = install.err
+					writeAttempt(&install)
+				}
+			}
+
+			for range retries + 1 {
+				if !installed {
+					break
+				}
+				attempt := runOnce(ctx, workDir, env, arg, limits, timeout, grace, stream, log)
+				result.attempts = append(result.attempts, attempt)
+				writeAttempt(&attempt)
+				result.stdout = attempt.stdout
+				result.exit = attempt.exit
+				result.time += attempt.time
+				result.err = attempt.err
+				if attempt.err == nil || ctx.Err() != nil {
+					break
+				}
+				tracker.UpdateMessage(result.String())
+			}
+			result.running = false
+			if logErr != nil && result.err == nil {
+				result.err = logErr
+			}
+
+			// removed before reporting back, so it's gone by the time the
+			// matrix finishes
+			if isolation != nil && !keep {
+				if err := isolation.Remove(); err != nil {
+					fmt.Fprintf(os.Stderr, "error removing %s: %s\n", isolation.Root, err)
+				}
+			}
+
+			if result.attempts[len(result.attempts)-1].stopped {
+				result.canceled = true
+				result.exit = "canceled"
+				result.err = context.Cause(ctx)
+			}
+			results <- *result
+		}()
+	}
+
+	resultsSlice := []runResult{}
+
+	for range entries {
+		result := <-results
+		resultsSlice = append(resultsSlice, result)
+	}
+	cells.Wait()
+	<-rendered
+
+	errs := []error{}
+
+	sort.Slice(resultsSlice, func(i, j int) bool {
+		return resultsSlice[i].pattern < resultsSlice[j].pattern
+	})
+
+	width := 80
+	if fd, ok := terminalFd(cmd.Writer); ok {
+		if size, _, err := term.GetSize(fd); err == nil {
+			width = size
+		}
+	}
+	width -= 2
+	header := strings.Repeat("*", width)
+
+	printed := 0
+	for _, result := range resultsSlice {
+		if result.err != nil {
+			errs = append(errs, multierror.Prefix(result.err, result.pattern))
+		} else if summaryOnly {
+			continue
+		}
+		if printed > 0 {
+			fmt.Fprintln(cmd.Writer)
+		}
+		printed++
+		fmt.Fprintln(cmd.Writer, header)
+		label := result.String()
+		pad := strings.Repeat("-", max((width-len(label))/2, 0))
+		label = pad + label + pad
+		fmt.Fprintln(cmd.Writer, label)
+		if len(result.attempts) > 1 {
+			for i, attempt := range result.attempts {
+				fmt.Fprintf(cmd.Writer, "attempt %d: %s\n", i+1, attempt.String())
+				cmd.Writer.Write([]byte(attempt.stdout))
+			}
+		} else {
+			cmd.Writer.Write([]byte(result.stdout))
+		}
+		fmt.Fprintln(cmd.Writer, label)
+		fmt.Fprintln(cmd.Writer, header)
+	}
+
+	if printed > 0 {
+		fmt.Fprintln(cmd.Writer)
+	}
+	report := &MatrixReport{Command: arg}
+	for _, result := range resultsSlice {
+		report.Results = append(report.Results, result.report())
+	}
+	fmt.Fprintln(cmd.Writer, report.SummaryTable())
+
+	if slices.ContainsFunc(entries, func(e matrixEntry) bool {
+		return slices.ContainsFunc(e.axes, func(v MatrixAxisValue) bool { return v.Name == "gemfile" })
+	}) {
+		fmt.Fprintln(cmd.Writer)
+		fmt.Fprintln(cmd.Writer, report.GemfileTable())
+	}
+
+	if err := writeReports(config, cmd, reports, report); err != nil {
+		errs = append(errs, err)
+	}
+
+	if len(errs) > 0 {
+		return multierror.Append(nil, errs...)
+	}
+
+	return nil
+}
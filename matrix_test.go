@@ -0,0 +1,376 @@
+package chrb_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segiddins/chrb"
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli/v3"
+)
+
+// maxConcurrent is the most runs that were going at once, from a log of
+// start and end lines.
+func maxConcurrent(log string) int {
+	running, most := 0, 0
+	for _, line := range strings.Split(strings.TrimSpace(log), "\n") {
+		switch line {
+		case "start":
+			running++
+			most = max(most, running)
+		case "end":
+			running--
+		}
+	}
+	return most
+}
+
+// lockedBuffer is an output buffer that can be read while chrb is still
+// writing to it.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestMatrix_Jobs(t *testing.T) {
+	config, log := newRunConfig(t, "3.2.1", "3.3.6", "3.4.1")
+	t.Setenv("PATH", testPath)
+	// each run waits until the test releases it, so the progress shows a
+	// known state until then
+	release := t.TempDir()
+	script := `echo "$RUBY_VERSION" >>"$CHRB_TEST_LOG"; while [ ! -e "$0/$RUBY_VERSION" ]; do sleep 0.05; done`
+
+	app := chrb.App(config)
+	out := &lockedBuffer{}
+	app.Writer = out
+	app.ErrWriter = out
+	app.ExitErrHandler = func(context.Context, *cli.Command, error) {}
+	done := make(chan error, 1)
+	go func() {
+		done <- chrb.Run(context.Background(), app, []string{"chrb", "matrix", "--jobs", "2", "--ruby", "all", "--", "sh", "-c", script, release})
+	}()
+	started := func() []string {
+		content, _ := os.ReadFile(log)
+		return strings.Fields(string(content))
+	}
+	releaseStarted := func() {
+		for _, version := range started() {
+			assert.NoError(t, os.WriteFile(filepath.Join(release, version), nil, 0644))
+		}
+	}
+	waitFor := func(s string) bool {
+		return assert.Eventually(t, func() bool { return strings.Contains(out.String(), s) }, 10*time.Second, 10*time.Millisecond, s)
+	}
+
+	if waitFor("2 running, 1 queued") {
+		assert.Len(t, started(), 2)
+	}
+	releaseStarted()
+	if waitFor("1 running, 0 queued") {
+		assert.Len(t, started(), 3)
+	}
+	releaseStarted()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("matrix didn't finish")
+	}
+	assert.NotContains(t, out.String(), "3 running")
+	readLog(t, log)
+
+	script = `echo start >>"$CHRB_TEST_LOG"; sleep 0.1; echo end >>"$CHRB_TEST_LOG"`
+	_, err := runApp(config, "matrix", "--jobs", "1", "--ruby", "all", "--", "sh", "-c", script)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, maxConcurrent(readLog(t, log)))
+}
+
+// runMatrix runs matrix with args, returning its JSON report as well as its
+// output.
+func runMatrix(t *testing.T, config *chrb.Config, args ...string) (*chrb.MatrixReport, string, error) {
+	path := filepath.Join(t.TempDir(), "report.json")
+	args = append([]string{"matrix", "--report", "json=" + path}, args...)
+	out, err := runApp(config, args...)
+	content, readErr := os.ReadFile(path)
+	if !assert.NoError(t, readErr, out) {
+		return nil, out, err
+	}
+	report := &chrb.MatrixReport{}
+	assert.NoError(t, json.Unmarshal(content, report))
+	return report, out, err
+}
+
+func TestMatrix_BundleInstallFails(t *testing.T) {
+	config, log := newRunConfig(t, "3.3.6")
+	t.Setenv("PATH", testPath)
+	bundle := filepath.Join(config.Env.Getenv("HOME"), ".rubies", "ruby-3.3.6", "bin", "bundle")
+	assert.NoError(t, os.WriteFile(bundle, []byte("#!/bin/sh\necho \"bundle $*\" >>\"$CHRB_TEST_LOG\"\nexit 5\n"), 0755))
+
+	// the command never runs, so there's nothing to retry
+	report, _, err := runMatrix(t, config, "--bundle-install", "--retries", "2", "--ruby", "3.3", "--", "ruby", "-v")
+	assert.Error(t, err)
+	assert.Equal(t, "bundle install\n", readLog(t, log))
+	if report == nil || !assert.Len(t, report.Results, 1) {
+		return
+	}
+	result := report.Results[0]
+	assert.Equal(t, "bundle install exit status 5", result.Attempts[0].Exit)
+	assert.True(t, result.Attempts[0].Install)
+	assert.Equal(t, 0, result.CommandAttempts())
+}
+
+func TestMatrix_FailFast(t *testing.T) {
+	config, _ := newRunConfig(t, "3.2.1", "3.3.6", "3.4.1")
+	t.Setenv("PATH", testPath)
+	// whichever cell starts first fails, while the others would run for
+	// long enough to be canceled
+	lock := filepath.Join(t.TempDir(), "lock")
+	script := `if mkdir "$0" 2>/dev/null; then sleep 0.3; exit 1; fi; sleep 10`
+
+	start := time.Now()
+	report, _, err := runMatrix(t, config, "--fail-fast", "--jobs", "2", "--ruby", "all", "--", "sh", "-c", script, lock)
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 5*time.Second)
+	if report == nil {
+		return
+	}
+
+	failed, canceled, queued := 0, 0, 0
+	for _, result := range report.Results {
+		switch {
+		case result.Failed():
+			failed++
+			assert.Equal(t, 1, result.Status)
+		case result.Canceled && len(result.Attempts) > 0:
+			canceled++
+			assert.Equal(t, "canceled after another run failed", result.Error)
+		case result.Canceled:
+			queued++
+			assert.Equal(t, "canceled after another run failed", result.Error)
+		}
+	}
+	assert.Equal(t, 1, failed, "failed")
+	assert.Equal(t, 1, canceled, "running cells canceled")
+	assert.Equal(t, 1, queued, "queued cells canceled")
+}
+
+func TestMatrix_Timeout(t *testing.T) {
+	config, _ := newRunConfig(t, "3.3.6")
+	t.Setenv("PATH", testPath)
+
+	tests := []struct {
+		name   string
+		script string
+	}{
+		{name: "exits on SIGTERM", script: "sleep 10"},
+		// ignored by sleep too, so both are killed after the grace period
+		{name: "ignores SIGTERM", script: `trap "" TERM; sleep 10`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			start := time.Now()
+			report, _, err := runMatrix(t, config, "--timeout", "200ms", "--grace-period", "200ms", "--ruby", "3.3", "--", "sh", "-c", test.script)
+			assert.Error(t, err)
+			assert.Less(t, time.Since(start), 5*time.Second)
+			if report == nil {
+				return
+			}
+			result := report.Results[0]
+			assert.True(t, result.Failed())
+			assert.False(t, result.Canceled)
+			assert.Equal(t, "timed out after 200ms", result.Error)
+			if assert.Len(t, result.Attempts, 1) {
+				assert.Equal(t, "timed out after 200ms", result.Attempts[0].Exit)
+			}
+		})
+	}
+}
+
+func TestMatrix_Retries(t *testing.T) {
+	config, _ := newRunConfig(t, "3.3.6")
+	t.Setenv("PATH", testPath)
+	// fails the first time it's run, then passes
+	lock := filepath.Join(t.TempDir(), "lock")
+	script := `if mkdir "$0" 2>/dev/null; then echo first; exit 1; fi; echo second`
+
+	report, out, err := runMatrix(t, config, "--retries", "2", "--ruby", "3.3", "--", "sh", "-c", script, lock)
+	assert.NoError(t, err)
+	assert.Contains(t, out, "after 2 attempts")
+	if report != nil {
+		result := report.Results[0]
+		assert.False(t, result.Failed())
+		assert.Equal(t, 0, result.Status)
+		assert.Equal(t, "second\n", result.Output)
+		if assert.Len(t, result.Attempts, 2) {
+			assert.Equal(t, 1, result.Attempts[0].Status)
+			assert.Equal(t, "first\n", result.Attempts[0].Output)
+			assert.Equal(t, 0, result.Attempts[1].Status)
+			assert.Equal(t, result.Attempts[0].Duration+result.Attempts[1].Duration, result.Duration)
+			assert.Equal(t, result.Attempts[0].Usage.UserTime+result.Attempts[1].Usage.UserTime, result.Usage.UserTime)
+			assert.Equal(t, max(result.Attempts[0].Usage.MaxRSS, result.Attempts[1].Usage.MaxRSS), result.Usage.MaxRSS)
+		}
+	}
+
+	report, _, err = runMatrix(t, config, "--retries", "1", "--ruby", "3.3", "--", "sh", "-c", "exit 3")
+	assert.Error(t, err)
+	if report != nil {
+		result := report.Results[0]
+		assert.True(t, result.Failed())
+		assert.Equal(t, 3, result.Status)
+		assert.Len(t, result.Attempts, 2)
+	}
+}
+
+func TestMatrix_LogDir(t *testing.T) {
+	config, _ := newRunConfig(t, "3.3.6")
+	t.Setenv("PATH", testPath)
+	logDir := filepath.Join(t.TempDir(), "logs")
+
+	_, err := runApp(config, "matrix", "--log-dir", logDir, "--split-logs", "--ruby", "3.3", "--", "sh", "-c", "echo out; echo err >&2; exit 2")
+	assert.Error(t, err)
+
+	content, err := os.ReadFile(filepath.Join(logDir, "3.3.log"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), "# command: sh -c echo out; echo err >&2; exit 2\n")
+	assert.Contains(t, string(content), "out\n")
+	assert.Contains(t, string(content), "err\n")
+	assert.Regexp(t, `# attempt 1: exit status 2 in \S+ \(status 2\)\n$`, string(content))
+
+	content, err = os.ReadFile(filepath.Join(logDir, "3.3.stdout.log"))
+	assert.NoError(t, err)
+	assert.Equal(t, "out\n", string(content))
+	content, err = os.ReadFile(filepath.Join(logDir, "3.3.stderr.log"))
+	assert.NoError(t, err)
+	assert.Equal(t, "err\n", string(content))
+}
+
+func TestMatrix_Gemfiles(t *testing.T) {
+	config, _ := newRunConfig(t, "3.3.6", "3.4.1")
+	t.Setenv("PATH", testPath)
+	for _, dir := range []string{"rails_7", "rails_8"} {
+		assert.NoError(t, os.MkdirAll(filepath.Join(config.Dir, "gemfiles", dir), 0755))
+		assert.NoError(t, os.WriteFile(filepath.Join(config.Dir, "gemfiles", dir, "Gemfile"), nil, 0644))
+	}
+	logDir := filepath.Join(t.TempDir(), "logs")
+	script := `case "$BUNDLE_GEMFILE" in */rails_8/Gemfile) [ "$RUBY_VERSION" = 3.4.1 ];; esac`
+
+	report, out, err := runMatrix(t, config, "--log-dir", logDir, "--gemfile", "gemfiles/*/Gemfile", "--ruby", "all", "--", "sh", "-c", script)
+	assert.Error(t, err)
+	assert.Contains(t, out, `
++------------+--------------------------+--------------------------+
+| ruby       | gemfiles/rails_7/Gemfile | gemfiles/rails_8/Gemfile |
++------------+--------------------------+--------------------------+
+| ruby 3.3.6 | pass                     | FAIL                     |
+| ruby 3.4.1 | pass                     | pass                     |
++------------+--------------------------+--------------------------+
+`)
+	if report != nil {
+		patterns := []string{}
+		for _, result := range report.Results {
+			patterns = append(patterns, result.Pattern)
+		}
+		assert.Equal(t, []string{
+			"ruby-3.3.6 gemfile=gemfiles/rails_7/Gemfile",
+			"ruby-3.3.6 gemfile=gemfiles/rails_8/Gemfile",
+			"ruby-3.4.1 gemfile=gemfiles/rails_7/Gemfile",
+			"ruby-3.4.1 gemfile=gemfiles/rails_8/Gemfile",
+		}, patterns)
+	}
+	logs, err := os.ReadDir(logDir)
+	assert.NoError(t, err)
+	assert.Len(t, logs, 4)
+
+	// the same gemfile given twice is only run once
+	report, _, err = runMatrix(t, config, "--gemfile", "gemfiles/rails_7/Gemfile", "--gemfile", filepath.Join(config.Dir, "gemfiles/rails_7/Gemfile"), "--ruby", "3.3", "--", "true")
+	assert.NoError(t, err)
+	if report != nil {
+		assert.Len(t, report.Results, 1)
+	}
+
+	assert.NoError(t, os.WriteFile(filepath.Join(config.Dir, "gemfiles", "rails_7.gemfile"), nil, 0644))
+	_, err = runApp(config, "matrix", "--gemfile", "gemfiles/rails_7", "--gemfile", "gemfiles/rails_7.gemfile", "--ruby", "3.3", "--", "true")
+	assert.EqualError(t, err, `more than one cell is labelled "3.3 gemfile=gemfiles/rails_7"`)
+	assert.NoError(t, os.WriteFile(filepath.Join(config.Dir, "gemfiles", "rails 7.gemfile"), nil, 0644))
+	_, err = runApp(config, "matrix", "--gemfile", "gemfiles/rails_7.gemfile", "--gemfile", "gemfiles/rails 7.gemfile", "--ruby", "3.3", "--", "true")
+	assert.EqualError(t, err, `cells "3.3 gemfile=gemfiles/rails_7" and "3.3 gemfile=gemfiles/rails 7" would share a log file`)
+}
+
+func TestMatrix_Isolate(t *testing.T) {
+	config, log := newRunConfig(t, "3.3.6", "3.4.1")
+	t.Setenv("PATH", testPath)
+	assert.NoError(t, os.WriteFile(filepath.Join(config.Dir, "Gemfile"), nil, 0644))
+	logDir := filepath.Join(config.Dir, "logs")
+	// each run leaves a file behind, and would see the other's if they
+	// shared a directory
+	script := `ls; pwd >>"$CHRB_TEST_LOG"; touch "ran-$RUBY_VERSION"`
+
+	report, _, err := runMatrix(t, config, "--isolate", "--log-dir", logDir, "--ruby", "all", "--", "sh", "-c", script)
+	assert.NoError(t, err)
+	if report != nil {
+		for _, result := range report.Results {
+			assert.Equal(t, "Gemfile\n", result.Output, result.Pattern)
+		}
+	}
+	dirs := strings.Fields(readLog(t, log))
+	if assert.Len(t, dirs, 2) {
+		assert.NotEqual(t, dirs[0], dirs[1])
+		assert.NotEqual(t, config.Dir, dirs[0])
+		assert.NoDirExists(t, dirs[0])
+	}
+	assert.NoFileExists(t, filepath.Join(config.Dir, "ran-3.3.6"))
+	assert.FileExists(t, filepath.Join(logDir, "ruby-3.3.6.log"))
+}
+
+func TestMatrix_Limits(t *testing.T) {
+	config, _ := newRunConfig(t, "3.3.6")
+	t.Setenv("PATH", testPath)
+
+	if runtime.GOOS == "darwin" {
+		_, err := runApp(config, "matrix", "--limit-memory", "1G", "--ruby", "3.3", "--", "true")
+		assert.ErrorContains(t, err, "not supported on macOS")
+		return
+	}
+
+	report, _, err := runMatrix(t, config, "--limit-files", "64", "--limit-memory", "1G", "--limit-cpu", "1500ms", "--ruby", "3.3", "--", "sh", "-c", "ulimit -n; ulimit -v; ulimit -t")
+	assert.NoError(t, err)
+	if report != nil {
+		assert.Equal(t, "64\n1048576\n2\n", report.Results[0].Output)
+	}
+
+	_, err = runApp(config, "matrix", "--limit-files", "-1", "--ruby", "3.3", "--", "true")
+	assert.EqualError(t, err, "resource limits must be positive")
+}
+
+func TestMatrix_EmptySelector(t *testing.T) {
+	config, _ := newRunConfig(t, "3.3.6")
+
+	for _, ruby := range []string{"", " ", "3.3,"} {
+		_, err := runApp(config, "matrix", "--ruby", ruby, "--", "true")
+		assert.EqualError(t, err, "empty ruby selector", ruby)
+	}
+
+	assert.NoError(t, os.WriteFile(filepath.Join(config.Dir, chrb.MatrixFileName), []byte("rubies: [\"\"]\ncommand: \"true\"\n"), 0644))
+	_, err := runApp(config, "matrix")
+	assert.EqualError(t, err, "empty ruby selector")
+}
@@ -0,0 +1,291 @@
+package chrb
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/spf13/afero"
+	"gopkg.in/yaml.v3"
+)
+
+const MatrixFileName = ".chrb-matrix.yml"
+
+var ErrNoMatrixFile = errors.New("no " + MatrixFileName + " found")
+
+// MatrixAxis is a dimension of the matrix besides the ruby. The gemfile axis
+// sets BUNDLE_GEMFILE, the rubyopt axis adds to RUBYOPT, and any other name
+// is an environment variable to set.
+type MatrixAxis struct {
+	Name   string
+	Values []string
+}
+
+// MatrixAxes keeps the axes in the order they're written in the file, which
+// is the order they appear in labels.
+type MatrixAxes []MatrixAxis
+
+func (a *MatrixAxes) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: axes must be a mapping of names to values", node.Line)
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		axis := MatrixAxis{Name: node.Content[i].Value}
+		if err := node.Content[i+1].Decode(&axis.Values); err != nil {
+			return err
+		}
+		if len(axis.Values) == 0 {
+			return fmt.Errorf("line %d: axis %s has no values", node.Content[i].Line, axis.Name)
+		}
+		*a = append(*a, axis)
+	}
+	return nil
+}
+
+// MatrixCommand is either a list of arguments, or a string run with sh -c.
+type MatrixCommand []string
+
+func (c *MatrixCommand) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*c = MatrixCommand{"sh", "-c", node.Value}
+		return nil
+	}
+	var args []string
+	if err := node.Decode(&args); err != nil {
+		return err
+	}
+	*c = args
+	return nil
+}
+
+// MatrixFile is a .chrb-matrix.yml, declaring what chrb matrix runs when it
+// isn't given rubies and a command.
+type MatrixFile struct {
+	Rubies  []string            `yaml:"rubies"`
+	Axes    MatrixAxes          `yaml:"axes"`
+	Exclude []map[string]string `yaml:"exclude"`
+	Command MatrixCommand       `yaml:"command"`
+	// BundleInstall runs bundle install in each cell before the command.
+	BundleInstall bool `yaml:"bundle_install"`
+
+	// Dir contains the file, and is what gemfile paths are relative to.
+	Dir string `yaml:"-"`
+}
+
+// FindMatrixFile walks up from dir to the nearest .chrb-matrix.yml.
+func FindMatrixFile(config *Config, dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for {
+		path := filepath.Join(dir, MatrixFileName)
+		exists, err := afero.Exists(config.Fs, path)
+		if err != nil {
+			return "", err
+		}
+		if exists {
+			return path, nil
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", ErrNoMatrixFile
+		}
+		dir = parent
+	}
+}
+
+func ReadMatrixFile(fs afero.Fs, path string) (*MatrixFile, error) {
+	content, err := afero.ReadFile(fs, path)
+	if err != nil {
+		return nil, err
+	}
+	var file MatrixFile
+	if err := yaml.Unmarshal(content, &file); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for _, exclude := range file.Exclude {
+		for name := range exclude {
+			if name != "ruby" && !slices.ContainsFunc(file.Axes, func(a MatrixAxis) bool { return a.Name == name }) {
+				return nil, fmt.Errorf("%s: exclude refers to unknown axis %q", path, name)
+			}
+		}
+	}
+	path, err = filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	file.Dir = filepath.Dir(path)
+	return &file, nil
+}
+
+// SetAxis replaces the axis with the same name, or adds it at the end.
+func (f *MatrixFile) SetAxis(axis MatrixAxis) {
+	for i := range f.Axes {
+		if f.Axes[i].Name == axis.Name {
+			f.Axes[i] = axis
+			return
+		}
+	}
+	f.Axes = append(f.Axes, axis)
+}
+
+// GlobGemfiles expands patterns such as gemfiles/*.gemfile relative to dir,
+// for use as a gemfile axis. Gemfiles inside dir are returned relative to it,
+// so they can be told apart in labels.
+func GlobGemfiles(fs afero.Fs, dir string, patterns []string) ([]string, error) {
+	gemfiles := []string{}
+	for _, pattern := range patterns {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(dir, pattern)
+		}
+		matches, err := afero.Glob(fs, pattern)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no gemfiles match %s", pattern)
+		}
+		for _, match := range matches {
+			if rel, err := filepath.Rel(dir, match); err == nil && filepath.IsLocal(rel) {
+				match = rel
+			}
+			if !slices.Contains(gemfiles, match) {
+				gemfiles = append(gemfiles, match)
+			}
+		}
+	}
+	return gemfiles, nil
+}
+
+// MatrixAxisValue is the value an axis takes in one cell of the matrix.
+type MatrixAxisValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// String labels the value as name=value. Gemfiles keep their directories,
+// as in gemfile=gemfiles/rails-7/Gemfile, since gemfiles often share a name.
+func (v MatrixAxisValue) String() string {
+	value := v.Value
+	switch {
+	case v.Name == "gemfile":
+		value = strings.TrimSuffix(filepath.ToSlash(value), ".gemfile")
+	case len(value) == 0:
+		value = `""`
+	}
+	return v.Name + "=" + value
+}
+
+// MatrixCell is one combination of a ruby and a value for every axis.
+type MatrixCell struct {
+	Ruby Ruby
+	Axes []MatrixAxisValue
+}
+
+// Cells is the cross product of rubies and the file's axes, without the
+// cells matching an exclude entry. An entry's ruby is a selector, as with
+// --ruby, and its other keys are axis values that must all match.
+func (f *MatrixFile) Cells(config *Config, rubies []Ruby) ([]MatrixCell, error) {
+	excludedRubies := make([]map[RubyDir]bool, len(f.Exclude))
+	for i, exclude := range f.Exclude {
+		selector, ok := exclude["ruby"]
+		if !ok {
+			continue
+		}
+		excludedRubies[i] = map[RubyDir]bool{}
+		matches, err := SelectRubies(config, selector)
+		if err != nil && !errors.Is(err, ErrNoRubiesMatch) {
+			return nil, err
+		}
+		for _, ruby := range matches {
+			excludedRubies[i][ruby.RubyDir] = true
+		}
+	}
+
+	excluded := func(cell MatrixCell) bool {
+		for i, exclude := range f.Exclude {
+			matches := true
+			if excludedRubies[i] != nil {
+				matches = excludedRubies[i][cell.Ruby.RubyDir]
+			}
+			for _, value := range cell.Axes {
+				if want, ok := exclude[value.Name]; ok && want != value.Value {
+					matches = false
+				}
+			}
+			if matches {
+				return true
+			}
+		}
+		return false
+	}
+
+	cells := []MatrixCell{}
+	for _, ruby := range rubies {
+		combinations := [][]MatrixAxisValue{{}}
+		for _, axis := range f.Axes {
+			next := [][]MatrixAxisValue{}
+			for _, combination := range combinations {
+				for _, value := range axis.Values {
+					next = append(next, append(slices.Clone(combination), MatrixAxisValue{Name: axis.Name, Value: value}))
+				}
+			}
+			combinations = next
+		}
+		for _, combination := range combinations {
+			cell := MatrixCell{Ruby: ruby, Axes: combination}
+			if !excluded(cell) {
+				cells = append(cells, cell)
+			}
+		}
+	}
+	return cells, nil
+}
+
+// Apply sets the cell's axis values in env.
+func (f *MatrixFile) Apply(env *Env, cell MatrixCell) {
+	for _, value := range cell.Axes {
+		switch value.Name {
+		case "gemfile":
+			gemfile := value.Value
+			if !filepath.IsAbs(gemfile) {
+				gemfile = filepath.Join(f.Dir, gemfile)
+			}
+			env.Setenv("BUNDLE_GEMFILE", gemfile)
+		case "rubyopt":
+			if len(value.Value) == 0 {
+				continue
+			}
+			if rubyOpt := env.Getenv("RUBYOPT"); len(rubyOpt) > 0 {
+				env.Setenv("RUBYOPT", rubyOpt+" "+value.Value)
+			} else {
+				env.Setenv("RUBYOPT", value.Value)
+			}
+		default:
+			env.Setenv(value.Name, value.Value)
+		}
+	}
+}
+
+// loadMatrixFile reads path, or the nearest .chrb-matrix.yml when path is
+// empty. It returns nil when there's no file and none was asked for.
+func loadMatrixFile(config *Config, path string) (*MatrixFile, error) {
+	if len(path) > 0 {
+		return ReadMatrixFile(config.Fs, path)
+	}
+	if len(config.Dir) == 0 {
+		return nil, nil
+	}
+	path, err := FindMatrixFile(config, config.Dir)
+	if errors.Is(err, ErrNoMatrixFile) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ReadMatrixFile(config.Fs, path)
+}
@@ -0,0 +1,135 @@
+package chrb_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/segiddins/chrb"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatrixFile(t *testing.T) {
+	config := &chrb.Config{
+		Fs:      afero.NewMemMapFs(),
+		Env:     chrb.ParseEnv([]string{"HOME=/Users/user", "RUBYOPT=-W0"}),
+		Dir:     "/src/app/lib",
+		Options: chrb.DefaultOptions.Clone(),
+	}
+	for _, name := range []string{"ruby-3.2.5", "ruby-3.3.6", "jruby-9.4.8.0"} {
+		assert.NoError(t, config.Fs.MkdirAll(filepath.Join("/Users/user/.rubies", name, "bin"), 0755))
+	}
+	assert.NoError(t, config.Fs.MkdirAll(config.Dir, 0755))
+	assert.NoError(t, afero.WriteFile(config.Fs, "/src/app/.chrb-matrix.yml", []byte(`
+rubies: [ruby, jruby]
+axes:
+  gemfile: [gemfiles/rails_7.gemfile, gemfiles/rails_8.gemfile]
+  rubyopt: ["", --enable=frozen-string-literal]
+exclude:
+  - ruby: jruby
+    gemfile: gemfiles/rails_8.gemfile
+  - ruby: "< 3.3"
+    rubyopt: --enable=frozen-string-literal
+command: bundle exec rake
+`), 0644))
+
+	path, err := chrb.FindMatrixFile(config, config.Dir)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "/src/app/.chrb-matrix.yml", path)
+
+	file, err := chrb.ReadMatrixFile(config.Fs, path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "/src/app", file.Dir)
+	assert.Equal(t, []string{"ruby", "jruby"}, file.Rubies)
+	assert.Equal(t, chrb.MatrixCommand{"sh", "-c", "bundle exec rake"}, file.Command)
+	assert.Equal(t, []string{"gemfile", "rubyopt"}, []string{file.Axes[0].Name, file.Axes[1].Name})
+
+	rubies, err := chrb.SelectRubies(config, "all")
+	if !assert.NoError(t, err) {
+		return
+	}
+	cells, err := file.Cells(config, rubies)
+	if !assert.NoError(t, err) {
+		return
+	}
+	labels := []string{}
+	for _, cell := range cells {
+		label := cell.Ruby.Engine + "-" + cell.Ruby.Version
+		for _, value := range cell.Axes {
+			label += " " + value.String()
+		}
+		labels = append(labels, label)
+	}
+	assert.Equal(t, []string{
+		`jruby-9.4.8.0 gemfile=gemfiles/rails_7 rubyopt=""`,
+		`jruby-9.4.8.0 gemfile=gemfiles/rails_7 rubyopt=--enable=frozen-string-literal`,
+		`ruby-3.2.5 gemfile=gemfiles/rails_7 rubyopt=""`,
+		`ruby-3.2.5 gemfile=gemfiles/rails_8 rubyopt=""`,
+		`ruby-3.3.6 gemfile=gemfiles/rails_7 rubyopt=""`,
+		`ruby-3.3.6 gemfile=gemfiles/rails_7 rubyopt=--enable=frozen-string-literal`,
+		`ruby-3.3.6 gemfile=gemfiles/rails_8 rubyopt=""`,
+		`ruby-3.3.6 gemfile=gemfiles/rails_8 rubyopt=--enable=frozen-string-literal`,
+	}, labels)
+
+	env := config.Env.Clone()
+	file.Apply(env, cells[1])
+	assert.Equal(t, "/src/app/gemfiles/rails_7.gemfile", env.Getenv("BUNDLE_GEMFILE"))
+	assert.Equal(t, "-W0 --enable=frozen-string-literal", env.Getenv("RUBYOPT"))
+
+	assert.NoError(t, afero.WriteFile(config.Fs, "/src/bad.yml", []byte("axes:\n  DB: [pg]\nexclude:\n  - {db: pg}\n"), 0644))
+	_, err = chrb.ReadMatrixFile(config.Fs, "/src/bad.yml")
+	assert.ErrorContains(t, err, `unknown axis "db"`)
+
+	_, err = chrb.FindMatrixFile(config, "/src")
+	assert.ErrorIs(t, err, chrb.ErrNoMatrixFile)
+}
+
+func TestGlobGemfiles(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	for _, path := range []string{
+		"/src/app/Gemfile",
+		"/src/app/gemfiles/rails_7/Gemfile",
+		"/src/app/gemfiles/rails_8/Gemfile",
+		"/src/app/gemfiles/sinatra.gemfile",
+		"/src/other/Gemfile",
+	} {
+		assert.NoError(t, afero.WriteFile(fs, path, []byte("source 'https://rubygems.org'\n"), 0644))
+	}
+
+	gemfiles, err := chrb.GlobGemfiles(fs, "/src/app", []string{"Gemfile", "gemfiles/*/Gemfile", "gemfiles/rails_7/Gemfile", "/src/other/Gemfile"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Gemfile", "gemfiles/rails_7/Gemfile", "gemfiles/rails_8/Gemfile", "/src/other/Gemfile"}, gemfiles)
+
+	labels := []string{}
+	for _, gemfile := range append(gemfiles, "gemfiles/sinatra.gemfile") {
+		labels = append(labels, chrb.MatrixAxisValue{Name: "gemfile", Value: gemfile}.String())
+	}
+	assert.Equal(t, []string{
+		"gemfile=Gemfile",
+		"gemfile=gemfiles/rails_7/Gemfile",
+		"gemfile=gemfiles/rails_8/Gemfile",
+		"gemfile=/src/other/Gemfile",
+		"gemfile=gemfiles/sinatra",
+	}, labels)
+
+	_, err = chrb.GlobGemfiles(fs, "/src/app", []string{"gemfiles/*.rb"})
+	assert.EqualError(t, err, "no gemfiles match /src/app/gemfiles/*.rb")
+}
+
+func TestMatrixFile_SetAxis(t *testing.T) {
+	file := &chrb.MatrixFile{Axes: chrb.MatrixAxes{
+		{Name: "gemfile", Values: []string{"Gemfile"}},
+		{Name: "DB", Values: []string{"pg", "mysql"}},
+	}}
+	file.SetAxis(chrb.MatrixAxis{Name: "gemfile", Values: []string{"gemfiles/rails_7.gemfile"}})
+	file.SetAxis(chrb.MatrixAxis{Name: "rubyopt", Values: []string{"-W0"}})
+	assert.Equal(t, chrb.MatrixAxes{
+		{Name: "gemfile", Values: []string{"gemfiles/rails_7.gemfile"}},
+		{Name: "DB", Values: []string{"pg", "mysql"}},
+		{Name: "rubyopt", Values: []string{"-W0"}},
+	}, file.Axes)
+}
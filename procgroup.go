@@ -0,0 +1,22 @@
+package chrb
+
+import (
+	"context"
+	"os/exec"
+	"time"
+)
+
+// CommandInProcessGroup is exec.CommandContext for a command started in its
+// own process group. Cancelling ctx asks the whole group to terminate, and
+// kills whatever is left of it once grace has passed, so a test suite's own
+// children don't outlive it.
+func CommandInProcessGroup(ctx context.Context, grace time.Duration, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	setProcessGroup(cmd)
+	cmd.Cancel = func() error {
+		return stopProcessGroup(cmd.Process, grace)
+	}
+	// stragglers that escaped the group may still hold stdout open
+	cmd.WaitDelay = grace + time.Second
+	return cmd
+}
@@ -0,0 +1,20 @@
+//go:build windows
+
+package chrb
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP}
+}
+
+// stopProcessGroup kills p outright, since windows has no equivalent of
+// SIGTERM to ask a console process group to exit.
+func stopProcessGroup(p *os.Process, grace time.Duration) error {
+	return p.Kill()
+}
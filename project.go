@@ -0,0 +1,108 @@
+package chrb
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+var ErrNoRubyVersion = errors.New("no ruby version file found")
+
+const ProjectOptionsFile = ".chrb.json"
+
+type Project struct {
+	Root        string   `json:"root"`
+	RubyVersion string   `json:"ruby_version"`
+	Options     *Options `json:"options,omitempty"`
+}
+
+// FindProject walks up from dir until it finds a directory containing a
+// .ruby-version file, which is considered the project root.
+func FindProject(config *Config, dir string) (*Project, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		isDir, err := afero.DirExists(config.Fs, dir)
+		if err != nil {
+			return nil, err
+		}
+		if !isDir {
+			return nil, fmt.Errorf("%s is not a directory", dir)
+		}
+
+		content, err := afero.ReadFile(config.Fs, filepath.Join(dir, ".ruby-version"))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if err == nil {
+			options, err := readProjectOptions(config, dir)
+			if err != nil {
+				return nil, err
+			}
+			return &Project{
+				Root:        dir,
+				RubyVersion: strings.TrimSpace(string(content)),
+				Options:     options,
+			}, nil
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+
+	return nil, ErrNoRubyVersion
+}
+
+// Project returns the project containing the config's working directory, or
+// nil if there is none.
+func (config *Config) Project() (*Project, error) {
+	if len(config.Dir) == 0 {
+		return nil, nil
+	}
+	project, err := FindProject(config, config.Dir)
+	if errors.Is(err, ErrNoRubyVersion) {
+		return nil, nil
+	}
+	return project, err
+}
+
+func readProjectOptions(config *Config, dir string) (*Options, error) {
+	if config.TrustedOptionsOnly {
+		if trusted, err := IsTrustedProject(config, dir); err != nil || !trusted {
+			return nil, err
+		}
+	}
+	options, err := ReadOptionsFile(config.Fs, filepath.Join(dir, ProjectOptionsFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return options, err
+}
+
+// MergeOptions returns options with the project's own options applied on
+// top. It is safe to call on a nil project.
+func (p *Project) MergeOptions(options *Options) *Options {
+	options = options.Clone()
+	if p != nil && p.Options != nil {
+		options.Merge(p.Options)
+	}
+	return options
+}
+
+// Hash returns a short, stable identifier for the project root, suitable
+// for use in directory names.
+func (p *Project) Hash() string {
+	sum := sha256.Sum256([]byte(p.Root))
+	return hex.EncodeToString(sum[:])[:12]
+}
@@ -0,0 +1,225 @@
+package chrb
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// MatrixAttempt is one execution of the command for a ruby, or of the
+// bundle install before it when that fails, which is marked with Install.
+type MatrixAttempt struct {
+	Status   int           `json:"status"`
+	Exit     string        `json:"exit"`
+	Duration time.Duration `json:"duration_ns"`
+	Usage    ResourceUsage `json:"usage"`
+	Output   string        `json:"output"`
+	Install  bool          `json:"install,omitempty"`
+}
+
+// MatrixResult is the outcome of running the command with one ruby, as it
+// appears in matrix reports. Status is the exit status of the last attempt,
+// while Duration and Usage add up all of them, with MaxRSS the highest.
+type MatrixResult struct {
+	Pattern  string        `json:"pattern"`
+	Engine   string        `json:"engine"`
+	Version  string        `json:"version"`
+	RubyDir  RubyDir       `json:"ruby_dir"`
+	Status   int           `json:"status"`
+	Duration time.Duration `json:"duration_ns"`
+	Usage    ResourceUsage `json:"usage"`
+	Output   string        `json:"output"`
+	Error    string        `json:"error,omitempty"`
+	Canceled bool          `json:"canceled"`
+	// Axes are the cell's values for the axes of a matrix file.
+	Axes     []MatrixAxisValue `json:"axes,omitempty"`
+	Attempts []MatrixAttempt   `json:"attempts"`
+}
+
+func (r *MatrixResult) Name() string {
+	return fmt.Sprintf("%s (%s %s)", r.Pattern, r.Engine, r.Version)
+}
+
+func (r *MatrixResult) Failed() bool {
+	return len(r.Error) > 0 && !r.Canceled
+}
+
+// CommandAttempts counts the times the command itself ran, leaving out a
+// failed bundle install.
+func (r *MatrixResult) CommandAttempts() int {
+	attempts := 0
+	for _, attempt := range r.Attempts {
+		if !attempt.Install {
+			attempts++
+		}
+	}
+	return attempts
+}
+
+// MatrixReport is everything written by matrix --report.
+type MatrixReport struct {
+	Command []string       `json:"command"`
+	Results []MatrixResult `json:"results"`
+}
+
+// ReportFormats are the formats MatrixReport can be written in.
+var ReportFormats = []string{"json", "junit", "tap"}
+
+func (r *MatrixReport) Write(w io.Writer, format string) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	case "junit":
+		return r.writeJUnit(w)
+	case "tap":
+		return r.writeTAP(w)
+	}
+	return fmt.Errorf("invalid report format: %q", format)
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Skipped  int             `xml:"skipped,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Body    string `xml:",chardata"`
+}
+
+type junitTestCase struct {
+	Name       string          `xml:"name,attr"`
+	ClassName  string          `xml:"classname,attr"`
+	Time       string          `xml:"time,attr"`
+	Properties []junitProperty `xml:"properties>property"`
+	Failure    *junitMessage   `xml:"failure,omitempty"`
+	Skipped    *junitMessage   `xml:"skipped,omitempty"`
+	SystemOut  string          `xml:"system-out"`
+}
+
+func junitTime(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+func (r *MatrixReport) writeJUnit(w io.Writer) error {
+	suite := junitTestSuite{
+		Name:  strings.Join(r.Command, " "),
+		Tests: len(r.Results),
+	}
+	var total time.Duration
+	for _, result := range r.Results {
+		total += result.Duration
+		testCase := junitTestCase{
+			Name:      result.Name(),
+			ClassName: "chrb.matrix",
+			Time:      junitTime(result.Duration),
+			Properties: []junitProperty{
+				{Name: "ruby_dir", Value: string(result.RubyDir)},
+				{Name: "exit_status", Value: fmt.Sprint(result.Status)},
+				{Name: "attempts", Value: fmt.Sprint(result.CommandAttempts())},
+				{Name: "user_time", Value: junitTime(result.Usage.UserTime)},
+				{Name: "system_time", Value: junitTime(result.Usage.SystemTime)},
+				{Name: "max_rss_bytes", Value: fmt.Sprint(result.Usage.MaxRSS)},
+			},
+			SystemOut: result.Output,
+		}
+		for _, value := range result.Axes {
+			testCase.Properties = append(testCase.Properties, junitProperty{Name: "axis." + value.Name, Value: value.Value})
+		}
+		switch {
+		case result.Canceled:
+			suite.Skipped++
+			testCase.Skipped = &junitMessage{Message: result.Error}
+		case result.Failed():
+			suite.Failures++
+			testCase.Failure = &junitMessage{Message: result.Error, Body: result.Output}
+		}
+		suite.Cases = append(suite.Cases, testCase)
+	}
+	suite.Time = junitTime(total)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(junitTestSuites{Suites: []junitTestSuite{suite}}); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+type tapDiagnostic struct {
+	ExitStatus   int      `yaml:"exit_status"`
+	DurationMs   int64    `yaml:"duration_ms"`
+	UserTimeMs   int64    `yaml:"user_time_ms"`
+	SystemTimeMs int64    `yaml:"system_time_ms"`
+	MaxRSSBytes  int64    `yaml:"max_rss_bytes"`
+	Attempts     []string `yaml:"attempts,omitempty"`
+	Output       string   `yaml:"output"`
+}
+
+func (r *MatrixReport) writeTAP(w io.Writer) error {
+	fmt.Fprintf(w, "TAP version 13\n1..%d\n", len(r.Results))
+	for i, result := range r.Results {
+		switch {
+		case result.Canceled:
+			fmt.Fprintf(w, "ok %d - %s # SKIP %s\n", i+1, result.Name(), result.Error)
+		case result.Failed():
+			fmt.Fprintf(w, "not ok %d - %s\n", i+1, result.Name())
+		default:
+			fmt.Fprintf(w, "ok %d - %s\n", i+1, result.Name())
+		}
+
+		diagnostic := tapDiagnostic{
+			ExitStatus:   result.Status,
+			DurationMs:   result.Duration.Milliseconds(),
+			UserTimeMs:   result.Usage.UserTime.Milliseconds(),
+			SystemTimeMs: result.Usage.SystemTime.Milliseconds(),
+			MaxRSSBytes:  result.Usage.MaxRSS,
+			Output:       result.Output,
+		}
+		if len(result.Attempts) > 1 {
+			for _, attempt := range result.Attempts {
+				diagnostic.Attempts = append(diagnostic.Attempts, attempt.Exit)
+			}
+		}
+		var out bytes.Buffer
+		enc := yaml.NewEncoder(&out)
+		enc.SetIndent(2)
+		if err := enc.Encode(diagnostic); err != nil {
+			return err
+		}
+		fmt.Fprintln(w, "  ---")
+		for _, line := range strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n") {
+			fmt.Fprintf(w, "  %s\n", line)
+		}
+		if _, err := fmt.Fprintln(w, "  ..."); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package chrb_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"testing"
+	"time"
+
+	"github.com/segiddins/chrb"
+	"github.com/stretchr/testify/assert"
+)
+
+var matrixReport = &chrb.MatrixReport{
+	Command: []string{"rake", "test"},
+	Results: []chrb.MatrixResult{
+		{
+			Pattern: "3.3", Engine: "ruby", Version: "3.3.6", RubyDir: "/opt/rubies/ruby-3.3.6",
+			Status: 0, Duration: 1500 * time.Millisecond, Output: "2 tests\n",
+			Usage: chrb.ResourceUsage{UserTime: 800 * time.Millisecond, SystemTime: 100 * time.Millisecond, MaxRSS: 64 << 20},
+			Attempts: []chrb.MatrixAttempt{
+				{Status: 1, Exit: "exit status 1", Duration: 500 * time.Millisecond, Output: "flaky\n"},
+				{Status: 0, Exit: "exit status 0", Duration: time.Second, Output: "2 tests\n"},
+			},
+		},
+		{
+			Pattern: "jruby", Engine: "jruby", Version: "9.4.8.0", RubyDir: "/opt/rubies/jruby-9.4.8.0",
+			Status: 1, Duration: 2 * time.Second, Output: "1 failure\n", Error: "exit status 1",
+			Attempts: []chrb.MatrixAttempt{{Status: 1, Exit: "exit status 1", Duration: 2 * time.Second, Output: "1 failure\n"}},
+		},
+		{
+			Pattern: "truffleruby", Engine: "truffleruby", Version: "24.1.1", RubyDir: "/opt/rubies/truffleruby-24.1.1",
+			Status: -1, Error: "canceled after another run failed", Canceled: true, Attempts: []chrb.MatrixAttempt{},
+		},
+	},
+}
+
+func TestMatrixReport_JSON(t *testing.T) {
+	var out bytes.Buffer
+	assert.NoError(t, matrixReport.Write(&out, "json"))
+
+	var decoded chrb.MatrixReport
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &decoded))
+	assert.Equal(t, *matrixReport, decoded)
+}
+
+func TestMatrixReport_JUnit(t *testing.T) {
+	var out bytes.Buffer
+	assert.NoError(t, matrixReport.Write(&out, "junit"))
+
+	var decoded struct {
+		Suite struct {
+			Name     string `xml:"name,attr"`
+			Tests    int    `xml:"tests,attr"`
+			Failures int    `xml:"failures,attr"`
+			Skipped  int    `xml:"skipped,attr"`
+			Time     string `xml:"time,attr"`
+			Cases    []struct {
+				Name    string  `xml:"name,attr"`
+				Time    string  `xml:"time,attr"`
+				Failure *string `xml:"failure"`
+				Skipped *string `xml:"skipped"`
+				Output  string  `xml:"system-out"`
+			} `xml:"testcase"`
+		} `xml:"testsuite"`
+	}
+	if !assert.NoError(t, xml.Unmarshal(out.Bytes(), &decoded)) {
+		return
+	}
+	suite := decoded.Suite
+	assert.Equal(t, "rake test", suite.Name)
+	assert.Equal(t, 3, suite.Tests)
+	assert.Equal(t, 1, suite.Failures)
+	assert.Equal(t, 1, suite.Skipped)
+	assert.Equal(t, "3.500", suite.Time)
+	if assert.Len(t, suite.Cases, 3) {
+		assert.Equal(t, "3.3 (ruby 3.3.6)", suite.Cases[0].Name)
+		assert.Equal(t, "1.500", suite.Cases[0].Time)
+		assert.Nil(t, suite.Cases[0].Failure)
+		assert.Equal(t, "2 tests\n", suite.Cases[0].Output)
+		if assert.NotNil(t, suite.Cases[1].Failure) {
+			assert.Equal(t, "1 failure\n", *suite.Cases[1].Failure)
+		}
+		assert.NotNil(t, suite.Cases[2].Skipped)
+	}
+}
+
+func TestMatrixReport_TAP(t *testing.T) {
+	var out bytes.Buffer
+	assert.NoError(t, matrixReport.Write(&out, "tap"))
+	assert.Equal(t, `TAP version 13
+1..3
+ok 1 - 3.3 (ruby 3.3.6)
+  ---
+  exit_status: 0
+  duration_ms: 1500
+  user_time_ms: 800
+  system_time_ms: 100
+  max_rss_bytes: 67108864
+  attempts:
+    - exit status 1
+    - exit status 0
+  output: |
+    2 tests
+  ...
+not ok 2 - jruby (jruby 9.4.8.0)
+  ---
+  exit_status: 1
+  duration_ms: 2000
+  user_time_ms: 0
+  system_time_ms: 0
+  max_rss_bytes: 0
+  output: |
+    1 failure
+  ...
+ok 3 - truffleruby (truffleruby 24.1.1) # SKIP canceled after another run failed
+  ---
+  exit_status: -1
+  duration_ms: 0
+  user_time_ms: 0
+  system_time_ms: 0
+  max_rss_bytes: 0
+  output: ""
+  ...
+`, out.String())
+
+	assert.Error(t, matrixReport.Write(&out, "html"))
+}
@@ -0,0 +1,73 @@
+package chrb
+
+import (
+	"slices"
+	"strings"
+)
+
+// rubyOptKey records the RUBYOPT flags added by chrb, so ResetRubyEnv can
+// remove them again while keeping any flags the user set themselves.
+const rubyOptKey = "CHRB_RUBYOPT"
+
+// rubyOptArgFlags are the RUBYOPT flags that can take their argument as the
+// next word, as in -I lib.
+var rubyOptArgFlags = []string{"-I", "-r", "-E"}
+
+// splitRubyOpt splits RUBYOPT into flags, keeping each of rubyOptArgFlags
+// together with its argument, so "-I a -I b" is two flags rather than
+// three words.
+func splitRubyOpt(s string) []string {
+	flags := []string{}
+	words := strings.Fields(s)
+	for i := 0; i < len(words); i++ {
+		if slices.Contains(rubyOptArgFlags, words[i]) && i+1 < len(words) {
+			flags = append(flags, words[i]+" "+words[i+1])
+			i++
+			continue
+		}
+		flags = append(flags, words[i])
+	}
+	return flags
+}
+
+// applyRubyOpt appends the flags in fragments to RUBYOPT, skipping any that
+// are already present.
+func (e *Env) applyRubyOpt(fragments []string) {
+	flags := splitRubyOpt(e.Getenv("RUBYOPT"))
+	added := []string{}
+	for _, fragment := range fragments {
+		for _, flag := range splitRubyOpt(fragment) {
+			if slices.Contains(flags, flag) {
+				continue
+			}
+			flags = append(flags, flag)
+			added = append(added, flag)
+		}
+	}
+	if len(added) == 0 {
+		return
+	}
+
+	e.Setenv("RUBYOPT", strings.Join(flags, " "))
+	e.Setenv(rubyOptKey, strings.Join(added, " "))
+}
+
+func (e *Env) resetRubyOpt() {
+	added, ok := e.LookupEnv(rubyOptKey)
+	if !ok {
+		return
+	}
+	e.Unsetenv(rubyOptKey)
+
+	flags := splitRubyOpt(e.Getenv("RUBYOPT"))
+	for _, flag := range splitRubyOpt(added) {
+		if i := slices.Index(flags, flag); i >= 0 {
+			flags = slices.Delete(flags, i, i+1)
+		}
+	}
+	if len(flags) == 0 {
+		e.Unsetenv("RUBYOPT")
+	} else {
+		e.Setenv("RUBYOPT", strings.Join(flags, " "))
+	}
+}
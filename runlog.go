@@ -0,0 +1,100 @@
+package chrb
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+var unsafeFileNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// SafeFileName turns a matrix label into something usable as a file name.
+func SafeFileName(name string) string {
+	return unsafeFileNameChars.ReplaceAllString(name, "_")
+}
+
+// RunLog is the log file a matrix run's output is teed into, along with
+// separate stdout and stderr files when they're split.
+type RunLog struct {
+	file   afero.File
+	stdout afero.File
+	stderr afero.File
+}
+
+// OpenRunLog creates dir/<name>.log, plus .stdout.log and .stderr.log when
+// split is set.
+func OpenRunLog(fs afero.Fs, dir, name string, split bool) (*RunLog, error) {
+	name = SafeFileName(name)
+	log := &RunLog{}
+	var err error
+	if log.file, err = fs.Create(filepath.Join(dir, name+".log")); err != nil {
+		return nil, err
+	}
+	if split {
+		if log.stdout, err = fs.Create(filepath.Join(dir, name+".stdout.log")); err != nil {
+			log.Close()
+			return nil, err
+		}
+		if log.stderr, err = fs.Create(filepath.Join(dir, name+".stderr.log")); err != nil {
+			log.Close()
+			return nil, err
+		}
+	}
+	return log, nil
+}
+
+// WriteHeader starts the log with the command and the environment it's run
+// in, so a log can be read on its own.
+func (l *RunLog) WriteHeader(command []string, ruby *Ruby, ops []EnvOp, start time.Time) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# command: %s\n", strings.Join(command, " "))
+	fmt.Fprintf(&b, "# ruby: %s %s (%s)\n", ruby.Engine, ruby.Version, ruby.RubyDir)
+	fmt.Fprintf(&b, "# started: %s\n", start.Format(time.RFC3339))
+	fmt.Fprintln(&b, "# env:")
+	for _, op := range ops {
+		if op.Kind == EnvOpUnset {
+			fmt.Fprintf(&b, "#   %s %s\n", op.Kind, op.Key)
+		} else {
+			fmt.Fprintf(&b, "#   %s %s=%s\n", op.Kind, op.Key, op.Value)
+		}
+	}
+	_, err := io.WriteString(l.file, b.String())
+	return err
+}
+
+// WriteAttempt records how the nth attempt ended, after its output.
+func (l *RunLog) WriteAttempt(n int, attempt MatrixAttempt) error {
+	_, err := fmt.Fprintf(l.file, "# attempt %d: %s in %s (status %d)\n", n, attempt.Exit, attempt.Duration.Round(time.Millisecond), attempt.Status)
+	return err
+}
+
+func (l *RunLog) Close() error {
+	var err error
+	for _, f := range []afero.File{l.file, l.stdout, l.stderr} {
+		if f != nil {
+			if closeErr := f.Close(); closeErr != nil && err == nil {
+				err = closeErr
+			}
+		}
+	}
+	return err
+}
+
+// lockedWriter serializes writes from a command's stdout and stderr, which
+// are copied by separate goroutines once they go to different places.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (w *lockedWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Write(p)
+}
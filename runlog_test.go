@@ -0,0 +1,66 @@
+package chrb_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/segiddins/chrb"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSafeFileName(t *testing.T) {
+	assert.Equal(t, "ruby-3.3.6", chrb.SafeFileName("ruby-3.3.6"))
+	assert.Equal(t, "ruby_3.1", chrb.SafeFileName("ruby >= 3.1"))
+	assert.Equal(t, "ruby-3.3_gemfile_gemfiles_rails-7.gemfile", chrb.SafeFileName("ruby-3.3/gemfile=gemfiles/rails-7.gemfile"))
+}
+
+func TestOpenRunLog(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	ruby := &chrb.Ruby{Engine: "ruby", Version: "3.3.6", RubyDir: "/opt/rubies/ruby-3.3.6"}
+	ops := []chrb.EnvOp{
+		{Kind: chrb.EnvOpSet, Key: "RUBY_ROOT", Value: "/opt/rubies/ruby-3.3.6"},
+		{Kind: chrb.EnvOpUnset, Key: "GEM_PATH"},
+	}
+	start := time.Date(2024, 12, 25, 10, 30, 0, 0, time.UTC)
+
+	log, err := chrb.OpenRunLog(fs, "/logs", "ruby 3.3", false)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, log.WriteHeader([]string{"rake", "test"}, ruby, ops, start))
+	assert.NoError(t, log.WriteAttempt(1, chrb.MatrixAttempt{Status: 1, Exit: "exit status 1", Duration: 1500 * time.Millisecond}))
+	assert.NoError(t, log.Close())
+
+	content, err := afero.ReadFile(fs, "/logs/ruby_3.3.log")
+	assert.NoError(t, err)
+	assert.Equal(t, `# command: rake test
+# ruby: ruby 3.3.6 (/opt/rubies/ruby-3.3.6)
+# started: 2024-12-25T10:30:00Z
+# env:
+#   set RUBY_ROOT=/opt/rubies/ruby-3.3.6
+#   unset GEM_PATH
+# attempt 1: exit status 1 in 1.5s (status 1)
+`, string(content))
+	exists, _ := afero.Exists(fs, "/logs/ruby_3.3.stdout.log")
+	assert.False(t, exists)
+
+	// written to after it's closed
+	assert.Error(t, log.WriteAttempt(2, chrb.MatrixAttempt{Exit: "exit status 0"}))
+}
+
+func TestOpenRunLog_Split(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	log, err := chrb.OpenRunLog(fs, "/logs", "ruby-3.3.6", true)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, log.Close())
+	for _, name := range []string{"ruby-3.3.6.log", "ruby-3.3.6.stdout.log", "ruby-3.3.6.stderr.log"} {
+		exists, _ := afero.Exists(fs, "/logs/"+name)
+		assert.True(t, exists, name)
+	}
+
+	_, err = chrb.OpenRunLog(afero.NewReadOnlyFs(fs), "/logs", "ruby-3.4.1", true)
+	assert.Error(t, err)
+}
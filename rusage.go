@@ -0,0 +1,110 @@
+package chrb
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ResourceUsage is what a finished process used, including any children
+// it waited for.
+type ResourceUsage struct {
+	UserTime   time.Duration `json:"user_time_ns"`
+	SystemTime time.Duration `json:"system_time_ns"`
+	// MaxRSS is the peak resident set size in bytes, or 0 where the
+	// platform doesn't report it.
+	MaxRSS int64 `json:"max_rss_bytes"`
+}
+
+// add combines the usage of two processes run one after the other.
+func (u ResourceUsage) add(other ResourceUsage) ResourceUsage {
+	return ResourceUsage{
+		UserTime:   u.UserTime + other.UserTime,
+		SystemTime: u.SystemTime + other.SystemTime,
+		MaxRSS:     max(u.MaxRSS, other.MaxRSS),
+	}
+}
+
+func resourceUsage(state *os.ProcessState) ResourceUsage {
+	if state == nil {
+		return ResourceUsage{}
+	}
+	return ResourceUsage{
+		UserTime:   state.UserTime(),
+		SystemTime: state.SystemTime(),
+		MaxRSS:     maxRSS(state),
+	}
+}
+
+// ResourceLimits are applied to each run with ulimit. Zero values are left
+// unlimited.
+type ResourceLimits struct {
+	// Memory is the maximum virtual memory in bytes, which macOS doesn't
+	// enforce.
+	Memory int64
+	CPU    time.Duration
+	Files  int64
+}
+
+func (l ResourceLimits) IsZero() bool {
+	return l == ResourceLimits{}
+}
+
+// wrap returns args run through sh with the limits set first.
+func (l ResourceLimits) wrap(args []string) []string {
+	if l.IsZero() {
+		return args
+	}
+	ulimits := []string{}
+	if l.Memory > 0 {
+		ulimits = append(ulimits, fmt.Sprintf("ulimit -v %d", max(l.Memory/1024, 1)))
+	}
+	if l.CPU > 0 {
+		ulimits = append(ulimits, fmt.Sprintf("ulimit -t %d", max(int64(l.CPU.Round(time.Second)/time.Second), 1)))
+	}
+	if l.Files > 0 {
+		ulimits = append(ulimits, fmt.Sprintf("ulimit -n %d", l.Files))
+	}
+	script := strings.Join(ulimits, " && ") + ` && exec "$@"`
+	return append([]string{"sh", "-c", script, "sh"}, args...)
+}
+
+// ParseByteSize parses sizes like 512M or 2G, in powers of 1024, or a plain
+// number of bytes.
+func ParseByteSize(s string) (int64, error) {
+	units := map[string]int64{"K": 1 << 10, "M": 1 << 20, "G": 1 << 30, "T": 1 << 40}
+	number := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "B")
+	multiplier := int64(1)
+	if len(number) > 0 {
+		if unit, ok := units[number[len(number)-1:]]; ok {
+			multiplier = unit
+			number = number[:len(number)-1]
+		}
+	}
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil || math.IsNaN(n) || n < 0 {
+		return 0, fmt.Errorf("invalid size: %q", s)
+	}
+	// MaxInt64 rounds up to 2^63 as a float, so this also rejects infinity
+	size := n * float64(multiplier)
+	if size >= math.MaxInt64 {
+		return 0, fmt.Errorf("size too large: %q", s)
+	}
+	return int64(size), nil
+}
+
+// formatBytes is the inverse of ParseByteSize, for display.
+func formatBytes(n int64) string {
+	for _, unit := range []struct {
+		suffix string
+		size   int64
+	}{{"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10}} {
+		if n >= unit.size {
+			return fmt.Sprintf("%.1f%s", float64(n)/float64(unit.size), unit.suffix)
+		}
+	}
+	return fmt.Sprintf("%dB", n)
+}
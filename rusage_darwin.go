@@ -0,0 +1,16 @@
+//go:build darwin
+
+package chrb
+
+import (
+	"os"
+	"syscall"
+)
+
+// maxRSS converts ru_maxrss, which darwin reports in bytes.
+func maxRSS(state *os.ProcessState) int64 {
+	if rusage, ok := state.SysUsage().(*syscall.Rusage); ok {
+		return rusage.Maxrss
+	}
+	return 0
+}
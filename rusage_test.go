@@ -0,0 +1,28 @@
+package chrb_test
+
+import (
+	"testing"
+
+	"github.com/segiddins/chrb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseByteSize(t *testing.T) {
+	tests := map[string]int64{
+		"1024":     1024,
+		"512K":     512 << 10,
+		"2G":       2 << 30,
+		"1.5m":     3 << 19,
+		"64MB":     64 << 20,
+		"8388607T": 8388607 << 40,
+	}
+	for s, expected := range tests {
+		size, err := chrb.ParseByteSize(s)
+		assert.NoError(t, err, s)
+		assert.Equal(t, expected, size, s)
+	}
+	for _, s := range []string{"", "G", "-1M", "lots", "NaN", "nanK", "Inf", "+InfG", "1e400", "9223372036854775807", "8388608T"} {
+		_, err := chrb.ParseByteSize(s)
+		assert.Error(t, err, s)
+	}
+}
@@ -0,0 +1,16 @@
+//go:build unix && !darwin
+
+package chrb
+
+import (
+	"os"
+	"syscall"
+)
+
+// maxRSS converts ru_maxrss, which linux and the BSDs report in kilobytes.
+func maxRSS(state *os.ProcessState) int64 {
+	if rusage, ok := state.SysUsage().(*syscall.Rusage); ok {
+		return int64(rusage.Maxrss) * 1024
+	}
+	return 0
+}
@@ -0,0 +1,10 @@
+//go:build windows
+
+package chrb
+
+import "os"
+
+// maxRSS is unknown on windows, whose rusage only has times.
+func maxRSS(state *os.ProcessState) int64 {
+	return 0
+}
@@ -0,0 +1,136 @@
+package chrb
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+var ErrNoRubiesMatch = errors.New("no installed rubies match")
+
+// rubySelector is a parsed matrix --ruby value. Anything that isn't "all",
+// an engine, or a version constraint is a plain pattern for FindRuby.
+type rubySelector struct {
+	all        bool
+	engine     string
+	constraint VersionConstraint
+	pattern    string
+}
+
+func parseRubySelector(config *Config, s string) (rubySelector, error) {
+	s = strings.TrimSpace(s)
+	if len(s) == 0 {
+		return rubySelector{}, fmt.Errorf("empty ruby selector")
+	}
+	if s == "all" {
+		return rubySelector{all: true}, nil
+	}
+
+	engine, rest := s, ""
+	if i := strings.IndexAny(s, " \t"); i >= 0 {
+		engine, rest = s[:i], strings.TrimSpace(s[i:])
+	}
+	if slices.Contains(config.Options.KnownEngines, engine) {
+		selector := rubySelector{engine: engine}
+		if len(rest) > 0 {
+			constraint, err := ParseVersionConstraint(rest)
+			if err != nil {
+				return rubySelector{}, err
+			}
+			selector.constraint = constraint
+		}
+		return selector, nil
+	}
+
+	// other engines' versions don't line up with ruby's, so a constraint
+	// without an engine only means MRI
+	if strings.ContainsAny(s[:1], "=!<>~") {
+		constraint, err := ParseVersionConstraint(s)
+		if err != nil {
+			return rubySelector{}, err
+		}
+		return rubySelector{engine: "ruby", constraint: constraint}, nil
+	}
+
+	return rubySelector{pattern: s}, nil
+}
+
+// SelectRubies expands a selector to the installed rubies it matches: "all",
+// an engine name for every version of it, an engine followed by a version
+// constraint such as "ruby >= 3.1", or a bare constraint for MRI. Anything
+// else is a pattern selecting a single ruby, as with FindRuby.
+func SelectRubies(config *Config, selector string) ([]Ruby, error) {
+	parsed, err := parseRubySelector(config, selector)
+	if err != nil {
+		return nil, err
+	}
+
+	rubies, err := ListRubies(config)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(parsed.pattern) > 0 {
+		ruby, err := FindRuby(parsed.pattern, config)
+		if err != nil {
+			return nil, fmt.Errorf("%w %q: %s", ErrNoRubiesMatch, selector, err)
+		}
+		return []Ruby{ruby}, nil
+	}
+
+	selected := slices.DeleteFunc(rubies, func(r Ruby) bool {
+		if parsed.all {
+			return false
+		}
+		return r.Engine != parsed.engine || (parsed.constraint != nil && !parsed.constraint.Matches(r.Version))
+	})
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("%w %q", ErrNoRubiesMatch, selector)
+	}
+	return selected, nil
+}
+
+// ExcludeRubies removes the rubies matched by any of the selectors. Selectors
+// that match nothing are ignored.
+func ExcludeRubies(config *Config, rubies []Ruby, selectors []string) ([]Ruby, error) {
+	excluded := map[RubyDir]bool{}
+	for _, selector := range selectors {
+		matches, err := SelectRubies(config, selector)
+		if errors.Is(err, ErrNoRubiesMatch) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, ruby := range matches {
+			excluded[ruby.RubyDir] = true
+		}
+	}
+	return slices.DeleteFunc(slices.Clone(rubies), func(r Ruby) bool {
+		return excluded[r.RubyDir]
+	}), nil
+}
+
+// LatestPerMinor keeps only the newest ruby of each engine's minor versions,
+// such as 3.3.6 out of 3.3.5 and 3.3.6, preserving the order of the rest.
+func LatestPerMinor(rubies []Ruby) []Ruby {
+	minor := func(r Ruby) string {
+		segments := splitVersion(r.Version)
+		if len(segments) > 2 {
+			segments = segments[:2]
+		}
+		return r.Engine + " " + strings.Join(segments, ".")
+	}
+
+	latest := map[string]Ruby{}
+	for _, ruby := range rubies {
+		key := minor(ruby)
+		if current, ok := latest[key]; !ok || CompareVersions(ruby.Version, current.Version) > 0 {
+			latest[key] = ruby
+		}
+	}
+	return slices.DeleteFunc(slices.Clone(rubies), func(r Ruby) bool {
+		return latest[minor(r)].RubyDir != r.RubyDir
+	})
+}
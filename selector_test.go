@@ -0,0 +1,68 @@
+package chrb_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/segiddins/chrb"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelectRubies(t *testing.T) {
+	config := &chrb.Config{
+		Fs:      afero.NewMemMapFs(),
+		Env:     chrb.ParseEnv([]string{"HOME=/Users/user"}),
+		Options: chrb.DefaultOptions.Clone(),
+	}
+	for _, name := range []string{"ruby-3.1.6", "ruby-3.2.5", "ruby-3.3.5", "ruby-3.3.6", "ruby-3.10.0", "jruby-9.4.8.0", "truffleruby-24.1.1"} {
+		assert.NoError(t, config.Fs.MkdirAll(filepath.Join("/Users/user/.rubies", name, "bin"), 0755))
+	}
+
+	names := func(rubies []chrb.Ruby) []string {
+		names := []string{}
+		for _, ruby := range rubies {
+			names = append(names, filepath.Base(string(ruby.RubyDir)))
+		}
+		return names
+	}
+
+	tests := []struct {
+		selector string
+		expected []string
+	}{
+		{"all", []string{"jruby-9.4.8.0", "ruby-3.1.6", "ruby-3.2.5", "ruby-3.3.5", "ruby-3.3.6", "ruby-3.10.0", "truffleruby-24.1.1"}},
+		{"ruby", []string{"ruby-3.1.6", "ruby-3.2.5", "ruby-3.3.5", "ruby-3.3.6", "ruby-3.10.0"}},
+		{"jruby", []string{"jruby-9.4.8.0"}},
+		{"ruby >= 3.2, < 3.10", []string{"ruby-3.2.5", "ruby-3.3.5", "ruby-3.3.6"}},
+		{"ruby ~> 3.3.0", []string{"ruby-3.3.5", "ruby-3.3.6"}},
+		{">= 3.3", []string{"ruby-3.3.5", "ruby-3.3.6", "ruby-3.10.0"}},
+		{"3.3", []string{"ruby-3.3.6"}},
+		{"truffleruby-24", []string{"truffleruby-24.1.1"}},
+	}
+	for _, test := range tests {
+		t.Run(test.selector, func(t *testing.T) {
+			rubies, err := chrb.SelectRubies(config, test.selector)
+			if assert.NoError(t, err) {
+				assert.Equal(t, test.expected, names(rubies))
+			}
+		})
+	}
+
+	for _, selector := range []string{"", " ", "ruby < 3", "2.7", "mruby", "ruby >="} {
+		_, err := chrb.SelectRubies(config, selector)
+		assert.Error(t, err, selector)
+	}
+	_, err := chrb.SelectRubies(config, "ruby < 3")
+	assert.ErrorIs(t, err, chrb.ErrNoRubiesMatch)
+
+	all, err := chrb.SelectRubies(config, "all")
+	if !assert.NoError(t, err) {
+		return
+	}
+	rubies, err := chrb.ExcludeRubies(config, all, []string{"jruby", "ruby < 3.2", "2.7"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"ruby-3.2.5", "ruby-3.3.5", "ruby-3.3.6", "ruby-3.10.0", "truffleruby-24.1.1"}, names(rubies))
+		assert.Equal(t, []string{"ruby-3.2.5", "ruby-3.3.6", "ruby-3.10.0", "truffleruby-24.1.1"}, names(chrb.LatestPerMinor(rubies)))
+	}
+}
@@ -0,0 +1,81 @@
+package chrb
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Shell renders EnvOps as commands for a particular shell to eval.
+type Shell string
+
+const (
+	ShellPosix Shell = "posix"
+	ShellFish  Shell = "fish"
+)
+
+func ParseShell(name string) (Shell, error) {
+	switch filepath.Base(name) {
+	case "", "sh", "bash", "zsh", "dash", "ksh", "posix":
+		return ShellPosix, nil
+	case "fish":
+		return ShellFish, nil
+	}
+	return "", fmt.Errorf("unsupported shell: %q", name)
+}
+
+func (s Shell) Render(ops []EnvOp) string {
+	var b strings.Builder
+	for _, op := range ops {
+		switch s {
+		case ShellFish:
+			renderFish(&b, op)
+		default:
+			renderPosix(&b, op)
+		}
+	}
+	return b.String()
+}
+
+func posixQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func renderPosix(b *strings.Builder, op EnvOp) {
+	switch op.Kind {
+	case EnvOpSet:
+		fmt.Fprintf(b, "export %s=%s\n", op.Key, posixQuote(op.Value))
+	case EnvOpUnset:
+		fmt.Fprintf(b, "unset %s\n", op.Key)
+	case EnvOpPrepend:
+		fmt.Fprintf(b, "export %s=%s\"${%s:+:$%s}\"\n", op.Key, posixQuote(op.Value), op.Key, op.Key)
+	case EnvOpRemove:
+		// strip every occurrence of the entry using only parameter expansion,
+		// so it works the same in sh, bash and zsh
+		entry := posixQuote(":" + op.Value + ":")
+		fmt.Fprintf(b,
+			"__chrb_v=:$%s:; while :; do case $__chrb_v in *%s*) __chrb_v=${__chrb_v%%%%%s*}:${__chrb_v#*%s};; *) break;; esac; done; __chrb_v=${__chrb_v#:}; export %s=\"${__chrb_v%%:}\"; unset __chrb_v\n",
+			op.Key, entry, entry, entry, op.Key)
+	}
+}
+
+func fishQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, "'", `\'`)
+	return "'" + s + "'"
+}
+
+// renderFish relies on fish treating variables whose names end in PATH as
+// lists split on ':'.
+func renderFish(b *strings.Builder, op EnvOp) {
+	switch op.Kind {
+	case EnvOpSet:
+		fmt.Fprintf(b, "set -gx %s %s\n", op.Key, fishQuote(op.Value))
+	case EnvOpUnset:
+		fmt.Fprintf(b, "set -e %s\n", op.Key)
+	case EnvOpPrepend:
+		fmt.Fprintf(b, "set -gx %s %s $%s\n", op.Key, fishQuote(op.Value), op.Key)
+	case EnvOpRemove:
+		fmt.Fprintf(b, "while set -l __chrb_i (contains -i -- %s $%s); set -e %s[$__chrb_i]; end\n", fishQuote(op.Value), op.Key, op.Key)
+	}
+}
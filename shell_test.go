@@ -0,0 +1,112 @@
+package chrb_test
+
+import (
+	"os/exec"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/segiddins/chrb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnv_Ops(t *testing.T) {
+	tests := []struct {
+		name     string
+		original []string
+		updated  []string
+		ops      []chrb.EnvOp
+	}{
+		{
+			name:     "activate",
+			original: []string{"PATH=/usr/bin:/bin", "RUBYOPT=-w"},
+			updated:  []string{"PATH=/gem/bin:/ruby/bin:/usr/bin:/bin", "RUBY_ROOT=/ruby"},
+			ops: []chrb.EnvOp{
+				{Kind: chrb.EnvOpPrepend, Key: "PATH", Value: "/ruby/bin"},
+				{Kind: chrb.EnvOpPrepend, Key: "PATH", Value: "/gem/bin"},
+				{Kind: chrb.EnvOpUnset, Key: "RUBYOPT"},
+				{Kind: chrb.EnvOpSet, Key: "RUBY_ROOT", Value: "/ruby"},
+			},
+		},
+		{
+			name:     "switch keeps entries added by other tools",
+			original: []string{"PATH=/old/bin:/nvm/bin:/usr/bin:/old/bin"},
+			updated:  []string{"PATH=/new/bin:/nvm/bin:/usr/bin"},
+			ops: []chrb.EnvOp{
+				{Kind: chrb.EnvOpRemove, Key: "PATH", Value: "/old/bin"},
+				{Kind: chrb.EnvOpPrepend, Key: "PATH", Value: "/new/bin"},
+			},
+		},
+		{
+			name:     "reordered",
+			original: []string{"PATH=/a:/b"},
+			updated:  []string{"PATH=/b:/a"},
+			ops: []chrb.EnvOp{
+				{Kind: chrb.EnvOpSet, Key: "PATH", Value: "/b:/a"},
+			},
+		},
+		{
+			name:     "unset path",
+			original: []string{},
+			updated:  []string{"PATH=/ruby/bin"},
+			ops: []chrb.EnvOp{
+				{Kind: chrb.EnvOpSet, Key: "PATH", Value: "/ruby/bin"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			original := chrb.ParseEnv(test.original)
+			ops := chrb.ParseEnv(test.updated).Ops(original)
+			assert.Equal(t, test.ops, ops)
+
+			original.Apply(ops)
+			envList := original.ToEnvList()
+			slices.Sort(envList)
+			assert.Equal(t, test.updated, envList)
+		})
+	}
+}
+
+func TestShell_Render(t *testing.T) {
+	ops := []chrb.EnvOp{
+		{Kind: chrb.EnvOpRemove, Key: "PATH", Value: "/old ruby/bin"},
+		{Kind: chrb.EnvOpPrepend, Key: "PATH", Value: "/new ruby/bin"},
+		{Kind: chrb.EnvOpSet, Key: "RUBY_ROOT", Value: "/it's $HOME"},
+		{Kind: chrb.EnvOpUnset, Key: "RUBYOPT"},
+	}
+
+	assert.Equal(t, strings.Join([]string{
+		`while set -l __chrb_i (contains -i -- '/old ruby/bin' $PATH); set -e PATH[$__chrb_i]; end`,
+		`set -gx PATH '/new ruby/bin' $PATH`,
+		`set -gx RUBY_ROOT '/it\'s $HOME'`,
+		`set -e RUBYOPT`,
+		``,
+	}, "\n"), chrb.ShellFish.Render(ops))
+
+	script := chrb.ShellPosix.Render(ops) + `printf '%s\n' "$PATH" "$RUBY_ROOT" "${RUBYOPT-unset}"`
+	for _, sh := range []string{"sh", "bash", "zsh"} {
+		if len(shells[sh]) == 0 {
+			continue
+		}
+		t.Run(sh, func(t *testing.T) {
+			cmd := exec.Command(shells[sh], "-c", script)
+			cmd.Env = []string{"PATH=/old ruby/bin:/usr/bin:/old ruby/bin:/bin", "RUBYOPT=-w"}
+			out, err := cmd.Output()
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, "/new ruby/bin:/usr/bin:/bin\n/it's $HOME\nunset\n", string(out))
+		})
+	}
+}
+
+// shells are looked up before TestChrb clears the environment.
+var shells = func() map[string]string {
+	shells := map[string]string{}
+	for _, sh := range []string{"sh", "bash", "zsh"} {
+		shells[sh], _ = exec.LookPath(sh)
+	}
+	return shells
+}()
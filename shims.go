@@ -0,0 +1,112 @@
+package chrb
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/spf13/afero"
+)
+
+// defaultShims are always generated, even before any ruby is installed.
+var defaultShims = []string{"ruby", "gem", "bundle", "bundler", "irb", "erb", "rake"}
+
+// shimMarker identifies files written by WriteShims, so rehashing never
+// removes anything else in the directory.
+const shimMarker = "# chrb shim"
+
+// ShimsDir is where shims are written, from ShimsEnvPattern.
+func (o *Options) ShimsDir(env *Env) string {
+	return env.ExpandEnv(o.ShimsEnvPattern)
+}
+
+// ShimNames lists the executables to shim: the defaults plus everything in
+// the bin directories of every installed ruby and its gems. Rubies whose
+// environment can't be found are warned about on stderr and skipped.
+func ShimNames(config *Config, stderr io.Writer) ([]string, error) {
+	rubies, err := ListRubies(config)
+	if err != nil {
+		return nil, err
+	}
+
+	names := slices.Clone(defaultShims)
+	for _, ruby := range rubies {
+		dirs := []string{filepath.Join(string(ruby.RubyDir), "bin")}
+		env, err := ruby.Env(config)
+		if err != nil {
+			fmt.Fprintf(stderr, "error getting env for %s: %s\n", ruby.RubyDir, err)
+		} else {
+			for _, key := range []string{"GEM_ROOT", "GEM_HOME", "CHRB_GEM_HOME"} {
+				if dir := env.Getenv(key); len(dir) > 0 {
+					dirs = append(dirs, filepath.Join(dir, "bin"))
+				}
+			}
+		}
+
+		for _, dir := range dirs {
+			entries, err := afero.ReadDir(config.Fs, dir)
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			for _, entry := range entries {
+				if !entry.IsDir() && entry.Mode()&0o111 != 0 {
+					names = append(names, entry.Name())
+				}
+			}
+		}
+	}
+
+	slices.Sort(names)
+	return slices.Compact(names), nil
+}
+
+func shimScript(chrbPath, name string) []byte {
+	return []byte(fmt.Sprintf("#!/bin/sh\n%s\nexec %s exec -- %s \"$@\"\n", shimMarker, posixQuote(chrbPath), posixQuote(name)))
+}
+
+// WriteShims makes dir contain exactly one shim per name, each of which runs
+// the command with the ruby for the directory it is invoked from. It returns
+// the shims that were added and removed.
+func WriteShims(config *Config, dir, chrbPath string, names []string) (added, removed []string, err error) {
+	if err := config.Fs.MkdirAll(dir, 0755); err != nil {
+		return nil, nil, err
+	}
+
+	entries, err := afero.ReadDir(config.Fs, dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	existing := map[string]bool{}
+	for _, entry := range entries {
+		content, err := afero.ReadFile(config.Fs, filepath.Join(dir, entry.Name()))
+		if err != nil || !bytes.Contains(content, []byte(shimMarker)) {
+			continue
+		}
+		existing[entry.Name()] = true
+		if !slices.Contains(names, entry.Name()) {
+			if err := config.Fs.Remove(filepath.Join(dir, entry.Name())); err != nil {
+				return added, removed, err
+			}
+			removed = append(removed, entry.Name())
+		}
+	}
+
+	for _, name := range names {
+		if err := afero.WriteFile(config.Fs, filepath.Join(dir, name), shimScript(chrbPath, name), 0755); err != nil {
+			return added, removed, err
+		}
+		if err := config.Fs.Chmod(filepath.Join(dir, name), 0755); err != nil {
+			return added, removed, err
+		}
+		if !existing[name] {
+			added = append(added, name)
+		}
+	}
+	return added, removed, nil
+}
@@ -0,0 +1,70 @@
+package chrb_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/segiddins/chrb"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShims(t *testing.T) {
+	config := &chrb.Config{
+		Fs:      afero.NewMemMapFs(),
+		Env:     chrb.ParseEnv([]string{"HOME=/Users/user", "PATH=/usr/bin"}),
+		Uid:     501,
+		Options: chrb.DefaultOptions.Clone(),
+		RubyEnvFinder: func(r *chrb.Ruby) ([]string, error) {
+			if r.Version == "3.2.0" {
+				return nil, errors.New("broken")
+			}
+			return []string{
+				"RUBY_ENGINE=" + r.Engine,
+				"RUBY_VERSION=" + r.Version,
+				"GEM_ROOT=" + string(r.RubyDir) + "/lib/gems",
+			}, nil
+		},
+	}
+
+	rubyDir := chrb.RubyDir("/opt/rubies/ruby-3.3.6")
+	assert.NoError(t, afero.WriteFile(config.Fs, rubyDir.ExecPath(), []byte("ruby"), 0755))
+	assert.NoError(t, afero.WriteFile(config.Fs, "/opt/rubies/ruby-3.3.6/lib/gems/bin/rails", []byte("rails"), 0755))
+	assert.NoError(t, afero.WriteFile(config.Fs, "/Users/user/.gem/ruby/3.3.6/bin/rspec", []byte("rspec"), 0755))
+	assert.NoError(t, afero.WriteFile(config.Fs, "/Users/user/.gem/ruby/3.3.6/bin/README", []byte("readme"), 0644))
+
+	// a ruby whose environment can't be found still has its own bin shimmed
+	broken := chrb.RubyDir("/opt/rubies/ruby-3.2.0")
+	assert.NoError(t, afero.WriteFile(config.Fs, broken.ExecPath(), []byte("ruby"), 0755))
+
+	stderr := &bytes.Buffer{}
+	names, err := chrb.ShimNames(config, stderr)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "error getting env for /opt/rubies/ruby-3.2.0: failed to find env for ruby at /opt/rubies/ruby-3.2.0/bin/ruby: broken\n", stderr.String())
+	assert.Equal(t, []string{"bundle", "bundler", "erb", "gem", "irb", "rails", "rake", "rspec", "ruby"}, names)
+
+	dir := config.Options.ShimsDir(config.Env)
+	assert.Equal(t, "/Users/user/.chrb/shims", dir)
+	assert.NoError(t, afero.WriteFile(config.Fs, dir+"/other", []byte("not a shim"), 0755))
+
+	added, removed, err := chrb.WriteShims(config, dir, "/usr/local/bin/chrb", names)
+	if assert.NoError(t, err) {
+		assert.Equal(t, names, added)
+		assert.Empty(t, removed)
+	}
+	content, err := afero.ReadFile(config.Fs, dir+"/rspec")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "#!/bin/sh\n# chrb shim\nexec '/usr/local/bin/chrb' exec -- 'rspec' \"$@\"\n", string(content))
+	}
+
+	added, removed, err = chrb.WriteShims(config, dir, "/usr/local/bin/chrb", []string{"ruby", "rspec", "rubocop"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"rubocop"}, added)
+		assert.Equal(t, []string{"bundle", "bundler", "erb", "gem", "irb", "rails", "rake"}, removed)
+	}
+	exists, _ := afero.Exists(config.Fs, dir+"/other")
+	assert.True(t, exists)
+}
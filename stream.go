@@ -0,0 +1,100 @@
+package chrb
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/jedib0t/go-pretty/v6/text"
+	"golang.org/x/term"
+)
+
+// streamColors are cycled through to tell rubies apart in streamed output.
+var streamColors = []text.Colors{
+	{text.FgCyan},
+	{text.FgYellow},
+	{text.FgGreen},
+	{text.FgMagenta},
+	{text.FgBlue},
+	{text.FgHiCyan},
+	{text.FgHiYellow},
+	{text.FgHiGreen},
+	{text.FgHiMagenta},
+	{text.FgHiBlue},
+}
+
+// LineStream writes whole lines to out with a label in front of each, so
+// lines from concurrent runs sharing out never interleave.
+type LineStream struct {
+	mu     *sync.Mutex
+	out    io.Writer
+	prefix string
+	buf    []byte
+}
+
+// NewLineStreams makes a stream for each label, padding the labels to the
+// same width and colouring them when color is set.
+func NewLineStreams(out io.Writer, labels []string, color bool) []*LineStream {
+	width := 0
+	for _, label := range labels {
+		width = max(width, len(label))
+	}
+
+	mu := &sync.Mutex{}
+	streams := make([]*LineStream, len(labels))
+	for i, label := range labels {
+		prefix := fmt.Sprintf("%-*s | ", width, label)
+		if color {
+			prefix = streamColors[i%len(streamColors)].Sprint(prefix)
+		}
+		streams[i] = &LineStream{mu: mu, out: out, prefix: prefix}
+	}
+	return streams
+}
+
+func (s *LineStream) Write(p []byte) (int, error) {
+	s.buf = append(s.buf, p...)
+	for {
+		i := bytes.IndexByte(s.buf, '\n')
+		if i < 0 {
+			break
+		}
+		if err := s.writeLine(s.buf[:i+1]); err != nil {
+			return len(p), err
+		}
+		s.buf = s.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush writes out a final line that didn't end in a newline.
+func (s *LineStream) Flush() error {
+	if len(s.buf) == 0 {
+		return nil
+	}
+	line := append(s.buf, '\n')
+	s.buf = nil
+	return s.writeLine(line)
+}
+
+func (s *LineStream) writeLine(line []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := io.WriteString(s.out, s.prefix); err != nil {
+		return err
+	}
+	_, err := s.out.Write(line)
+	return err
+}
+
+// terminalFd returns the file descriptor behind w when w is a terminal, so
+// output only gets colours and terminal widths when it's shown in one.
+func terminalFd(w io.Writer) (int, bool) {
+	f, ok := w.(*os.File)
+	if !ok || !term.IsTerminal(int(f.Fd())) {
+		return 0, false
+	}
+	return int(f.Fd()), true
+}
@@ -0,0 +1,84 @@
+package chrb_test
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/segiddins/chrb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLineStream(t *testing.T) {
+	out := &bytes.Buffer{}
+	streams := chrb.NewLineStreams(out, []string{"3.3", "head"}, false)
+
+	fmt.Fprint(streams[0], "one\ntw")
+	assert.Equal(t, "3.3  | one\n", out.String())
+	fmt.Fprint(streams[0], "o\n")
+	fmt.Fprint(streams[1], "three")
+	assert.Equal(t, "3.3  | one\n3.3  | two\n", out.String())
+
+	// a last line without a newline is written when the run finishes
+	assert.NoError(t, streams[1].Flush())
+	assert.NoError(t, streams[0].Flush())
+	assert.Equal(t, "3.3  | one\n3.3  | two\nhead | three\n", out.String())
+}
+
+func TestLineStream_Color(t *testing.T) {
+	out := &bytes.Buffer{}
+	streams := chrb.NewLineStreams(out, []string{"3.3", "3.4"}, true)
+	fmt.Fprintln(streams[0], "one")
+	fmt.Fprintln(streams[1], "two")
+	assert.Equal(t, "\x1b[36m3.3 | \x1b[0mone\n\x1b[33m3.4 | \x1b[0mtwo\n", out.String())
+
+	out.Reset()
+	streams = chrb.NewLineStreams(out, []string{"3.3", "3.4"}, false)
+	fmt.Fprintln(streams[0], "one")
+	assert.NotContains(t, out.String(), "\x1b")
+}
+
+func TestLineStream_Concurrent(t *testing.T) {
+	out := &bytes.Buffer{}
+	labels := []string{"a", "b", "c", "d"}
+	streams := chrb.NewLineStreams(out, labels, false)
+
+	// every stream writes its lines a byte at a time, so unsynchronized
+	// writes would mix them up
+	wg := sync.WaitGroup{}
+	for i, stream := range streams {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			line := strings.Repeat(labels[i], 20) + "\n"
+			for range 50 {
+				for j := range line {
+					stream.Write([]byte{line[j]})
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	assert.Len(t, lines, 200)
+	for _, line := range lines {
+		label, content, _ := strings.Cut(line, " | ")
+		assert.Equal(t, strings.Repeat(label, 20), content)
+	}
+}
+
+func TestMatrix_Stream(t *testing.T) {
+	config, _ := newRunConfig(t, "3.3.6", "3.4.1")
+	t.Setenv("PATH", testPath)
+
+	out, err := runApp(config, "matrix", "--stream", "--ruby", "all", "--", "sh", "-c", `echo "$RUBY_VERSION"; printf partial`)
+	assert.NoError(t, err)
+	assert.Contains(t, out, "ruby-3.3.6 | 3.3.6\nruby-3.3.6 | partial\n")
+	assert.Contains(t, out, "ruby-3.4.1 | 3.4.1\nruby-3.4.1 | partial\n")
+	// the labels are only coloured when the writer itself is a terminal,
+	// whatever os.Stdout is
+	assert.NotContains(t, out, "\x1b")
+}
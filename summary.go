@@ -0,0 +1,124 @@
+package chrb
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+)
+
+// GemfileTable lays the results out with a row per ruby and a column per
+// gemfile. A cell covering several results, from other axes, counts how
+// many of them passed.
+func (r *MatrixReport) GemfileTable() string {
+	rubies := []string{}
+	gemfiles := []string{}
+	cells := map[[2]string][]MatrixResult{}
+	for _, result := range r.Results {
+		gemfile := ""
+		for _, value := range result.Axes {
+			if value.Name == "gemfile" {
+				gemfile = strings.TrimPrefix(value.String(), "gemfile=")
+			}
+		}
+		ruby := result.Engine + " " + result.Version
+		if !slices.Contains(rubies, ruby) {
+			rubies = append(rubies, ruby)
+		}
+		if !slices.Contains(gemfiles, gemfile) {
+			gemfiles = append(gemfiles, gemfile)
+		}
+		key := [2]string{ruby, gemfile}
+		cells[key] = append(cells[key], result)
+	}
+
+	t := table.NewWriter()
+	// gemfile names are case sensitive
+	t.Style().Format.Header = text.FormatDefault
+	header := table.Row{"ruby"}
+	for _, gemfile := range gemfiles {
+		header = append(header, gemfile)
+	}
+	t.AppendHeader(header)
+	for _, ruby := range rubies {
+		row := table.Row{ruby}
+		for _, gemfile := range gemfiles {
+			row = append(row, cellStatus(cells[[2]string{ruby, gemfile}]))
+		}
+		t.AppendRow(row)
+	}
+	return t.Render()
+}
+
+func cellStatus(results []MatrixResult) string {
+	if len(results) == 0 {
+		return "-"
+	}
+	if len(results) == 1 {
+		return results[0].status()
+	}
+	passed := 0
+	for _, result := range results {
+		if len(result.Error) == 0 {
+			passed++
+		}
+	}
+	return fmt.Sprintf("%d/%d passed", passed, len(results))
+}
+
+func (r *MatrixResult) status() string {
+	switch {
+	case r.Canceled:
+		return "canceled"
+	case len(r.Error) == 0:
+		return "pass"
+	}
+	return "FAIL"
+}
+
+// SummaryTable has a row per result, for a glance at the whole matrix after
+// the output of each run.
+func (r *MatrixReport) SummaryTable() string {
+	t := table.NewWriter()
+	t.AppendHeader(table.Row{"ruby", "version", "status", "exit code", "duration", "retries", "user", "sys", "max rss"})
+	t.SetColumnConfigs([]table.ColumnConfig{
+		{Name: "exit code", Align: text.AlignRight},
+		{Name: "duration", Align: text.AlignRight},
+		{Name: "retries", Align: text.AlignRight},
+		{Name: "user", Align: text.AlignRight},
+		{Name: "sys", Align: text.AlignRight},
+		{Name: "max rss", Align: text.AlignRight},
+	})
+	for _, result := range r.Results {
+		exitCode := "-"
+		if len(result.Attempts) > 0 && result.Status >= 0 {
+			exitCode = fmt.Sprint(result.Status)
+		}
+		duration, user, sys, rss := "-", "-", "-", "-"
+		if result.Duration > 0 {
+			duration = result.Duration.Round(time.Millisecond).String()
+		}
+		if len(result.Attempts) > 0 {
+			user = result.Usage.UserTime.Round(time.Millisecond).String()
+			sys = result.Usage.SystemTime.Round(time.Millisecond).String()
+			if result.Usage.MaxRSS > 0 {
+				rss = formatBytes(result.Usage.MaxRSS)
+			}
+		}
+		t.AppendRow(table.Row{
+			result.Pattern,
+			result.Engine + " " + result.Version,
+			result.status(),
+			exitCode,
+			duration,
+			max(result.CommandAttempts()-1, 0),
+			user,
+			sys,
+			rss,
+		})
+	}
+	return t.Render()
+}
@@ -0,0 +1,153 @@
+package chrb_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/segiddins/chrb"
+	"github.com/stretchr/testify/assert"
+)
+
+// tableRows returns the rows of a rendered table after its header, with the
+// padding squeezed out.
+func tableRows(table string) []string {
+	rows := []string{}
+	for _, line := range strings.Split(table, "\n")[3:] {
+		if strings.HasPrefix(line, "|") {
+			rows = append(rows, strings.Join(strings.Fields(line), " "))
+		}
+	}
+	return rows
+}
+
+func TestMatrixReport_SummaryTable(t *testing.T) {
+	tests := []struct {
+		name   string
+		result chrb.MatrixResult
+		row    string
+	}{
+		{
+			name: "pass",
+			result: chrb.MatrixResult{
+				Status:   0,
+				Duration: 1500 * time.Millisecond,
+				Usage:    chrb.ResourceUsage{UserTime: 1200 * time.Millisecond, SystemTime: 100 * time.Millisecond, MaxRSS: 50 << 20},
+				Attempts: []chrb.MatrixAttempt{{Status: 0, Exit: "exit status 0"}},
+			},
+			row: "| 3.3 | ruby 3.3.6 | pass | 0 | 1.5s | 0 | 1.2s | 100ms | 50.0M |",
+		},
+		{
+			name: "fail after a retry",
+			result: chrb.MatrixResult{
+				Status:   1,
+				Duration: 3 * time.Second,
+				Usage:    chrb.ResourceUsage{UserTime: time.Second},
+				Error:    "exit status 1",
+				Attempts: []chrb.MatrixAttempt{{Status: 1}, {Status: 1}},
+			},
+			row: "| 3.3 | ruby 3.3.6 | FAIL | 1 | 3s | 1 | 1s | 0s | - |",
+		},
+		{
+			name: "bundle install failed",
+			result: chrb.MatrixResult{
+				Status:   5,
+				Duration: time.Second,
+				Error:    "bundle install: exit status 5",
+				Attempts: []chrb.MatrixAttempt{{Status: 5, Exit: "bundle install exit status 5", Install: true}},
+			},
+			row: "| 3.3 | ruby 3.3.6 | FAIL | 5 | 1s | 0 | 0s | 0s | - |",
+		},
+		{
+			name: "timed out",
+			result: chrb.MatrixResult{
+				Status:   -1,
+				Duration: time.Second,
+				Error:    "timed out after 1s",
+				Attempts: []chrb.MatrixAttempt{{Status: -1, Exit: "timed out after 1s"}},
+			},
+			row: "| 3.3 | ruby 3.3.6 | FAIL | - | 1s | 0 | 0s | 0s | - |",
+		},
+		{
+			name: "canceled while running",
+			result: chrb.MatrixResult{
+				Status:   -1,
+				Duration: 200 * time.Millisecond,
+				Error:    "canceled after another run failed",
+				Canceled: true,
+				Attempts: []chrb.MatrixAttempt{{Status: -1, Exit: "canceled"}},
+			},
+			row: "| 3.3 | ruby 3.3.6 | canceled | - | 200ms | 0 | 0s | 0s | - |",
+		},
+		{
+			name: "canceled while queued",
+			result: chrb.MatrixResult{
+				Status:   -1,
+				Error:    "canceled after another run failed",
+				Canceled: true,
+				Attempts: []chrb.MatrixAttempt{},
+			},
+			row: "| 3.3 | ruby 3.3.6 | canceled | - | - | 0 | - | - | - |",
+		},
+		{
+			name: "no attempts",
+			result: chrb.MatrixResult{
+				Status:   -1,
+				Error:    "open logs/3.3.log: permission denied",
+				Attempts: []chrb.MatrixAttempt{},
+			},
+			row: "| 3.3 | ruby 3.3.6 | FAIL | - | - | 0 | - | - | - |",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := test.result
+			result.Pattern, result.Engine, result.Version = "3.3", "ruby", "3.3.6"
+			report := &chrb.MatrixReport{Results: []chrb.MatrixResult{result}}
+			assert.Equal(t, []string{test.row}, tableRows(report.SummaryTable()))
+		})
+	}
+}
+
+func TestMatrixReport_GemfileTable(t *testing.T) {
+	result := func(version, gemfile, db, err string) chrb.MatrixResult {
+		return chrb.MatrixResult{
+			Engine:  "ruby",
+			Version: version,
+			Error:   err,
+			Axes:    []chrb.MatrixAxisValue{{Name: "gemfile", Value: gemfile}, {Name: "DB", Value: db}},
+		}
+	}
+	report := &chrb.MatrixReport{Results: []chrb.MatrixResult{
+		result("3.3.6", "gemfiles/rails_7/Gemfile", "pg", ""),
+		result("3.3.6", "gemfiles/rails_7/Gemfile", "mysql", "exit status 1"),
+		result("3.3.6", "gemfiles/rails_8/Gemfile", "pg", ""),
+		result("3.3.6", "gemfiles/rails_8/Gemfile", "mysql", ""),
+		result("3.4.1", "gemfiles/rails_8/Gemfile", "pg", "exit status 1"),
+	}}
+	table := report.GemfileTable()
+	assert.Contains(t, table, "| ruby       | gemfiles/rails_7/Gemfile | gemfiles/rails_8/Gemfile |\n")
+	assert.Equal(t, []string{
+		"| ruby 3.3.6 | 1/2 passed | 2/2 passed |",
+		"| ruby 3.4.1 | - | FAIL |",
+	}, tableRows(table))
+}
+
+func TestMatrix_SummaryOnly(t *testing.T) {
+	config, _ := newRunConfig(t, "3.3.6", "3.4.1")
+	t.Setenv("PATH", testPath)
+	script := `echo "output of $RUBY_VERSION"; [ "$RUBY_VERSION" = 3.4.1 ]`
+
+	out, err := runApp(config, "matrix", "--ruby", "all", "--", "sh", "-c", script)
+	assert.Error(t, err)
+	assert.Contains(t, out, "output of 3.3.6\n")
+	assert.Contains(t, out, "output of 3.4.1\n")
+
+	out, err = runApp(config, "matrix", "--summary-only", "--ruby", "all", "--", "sh", "-c", script)
+	assert.Error(t, err)
+	assert.Contains(t, out, "output of 3.3.6\n")
+	assert.NotContains(t, out, "output of 3.4.1\n")
+	assert.Contains(t, out, "| ruby-3.3.6 | ruby 3.3.6 | FAIL   |         1 |")
+	assert.Contains(t, out, "| ruby-3.4.1 | ruby 3.4.1 | pass   |         0 |")
+}
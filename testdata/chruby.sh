@@ -0,0 +1,56 @@
+# chruby_reset and chruby_use from chruby 0.3.9, used to check that chrb
+# produces the same environment as chruby for the same inputs.
+
+function chruby_reset()
+{
+	[[ -z "$RUBY_ROOT" ]] && return
+
+	PATH=":$PATH:"; PATH="${PATH//:$RUBY_ROOT\/bin:/:}"
+	[[ -n "$GEM_ROOT" ]] && PATH="${PATH//:$GEM_ROOT\/bin:/:}"
+
+	if (( UID != 0 )); then
+		[[ -n "$GEM_HOME" ]] && PATH="${PATH//:$GEM_HOME\/bin:/:}"
+
+		GEM_PATH=":$GEM_PATH:"
+		[[ -n "$GEM_HOME" ]] && GEM_PATH="${GEM_PATH//:$GEM_HOME:/:}"
+		[[ -n "$GEM_ROOT" ]] && GEM_PATH="${GEM_PATH//:$GEM_ROOT:/:}"
+		GEM_PATH="${GEM_PATH#:}"; GEM_PATH="${GEM_PATH%:}"
+
+		unset GEM_HOME
+		[[ -z "$GEM_PATH" ]] && unset GEM_PATH
+	fi
+
+	PATH="${PATH#:}"; PATH="${PATH%:}"
+	unset RUBY_ROOT RUBY_ENGINE RUBY_VERSION RUBYOPT GEM_ROOT
+	hash -r
+}
+
+function chruby_use()
+{
+	if [[ ! -x "$1/bin/ruby" ]]; then
+		echo "chruby: $1/bin/ruby not executable" >&2
+		return 1
+	fi
+
+	[[ -n "$RUBY_ROOT" ]] && chruby_reset
+
+	export RUBY_ROOT="$1"
+	export RUBYOPT="$2"
+	export PATH="$RUBY_ROOT/bin:$PATH"
+
+	eval "$(RUBYGEMS_GEMDEPS="" "$RUBY_ROOT/bin/ruby" - <<EOS
+puts "export RUBY_ENGINE=#{Object.const_defined?(:RUBY_ENGINE) ? RUBY_ENGINE : 'ruby'};"
+puts "export RUBY_VERSION=#{RUBY_VERSION};"
+begin; require 'rubygems'; puts "export GEM_ROOT=#{Gem.default_dir.inspect};"; rescue LoadError; end
+EOS
+)"
+	export PATH="${GEM_ROOT:+$GEM_ROOT/bin:}$PATH"
+
+	if (( UID != 0 )); then
+		export GEM_HOME="$HOME/.gem/$RUBY_ENGINE/$RUBY_VERSION"
+		export GEM_PATH="$GEM_HOME${GEM_ROOT:+:$GEM_ROOT}${GEM_PATH:+:$GEM_PATH}"
+		export PATH="$GEM_HOME/bin:$PATH"
+	fi
+
+	hash -r
+}
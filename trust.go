@@ -0,0 +1,78 @@
+package chrb
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+// TrustedProjectsPath returns the file listing the roots of the projects
+// whose options the shell hook applies, one per line, next to the user's
+// options file.
+func TrustedProjectsPath(env *Env) string {
+	return filepath.Join(filepath.Dir(UserOptionsPath(env)), "trusted")
+}
+
+// TrustedProjects returns the roots of the projects the user has trusted.
+func TrustedProjects(config *Config) ([]string, error) {
+	content, err := afero.ReadFile(config.Fs, TrustedProjectsPath(config.Env))
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	roots := []string{}
+	for _, line := range strings.Split(string(content), "\n") {
+		if line = strings.TrimSpace(line); len(line) > 0 {
+			roots = append(roots, line)
+		}
+	}
+	return roots, nil
+}
+
+func IsTrustedProject(config *Config, root string) (bool, error) {
+	roots, err := TrustedProjects(config)
+	if err != nil {
+		return false, err
+	}
+	return slices.Contains(roots, root), nil
+}
+
+// TrustProject lets the shell hook apply the options of the project at root.
+func TrustProject(config *Config, root string) error {
+	roots, err := TrustedProjects(config)
+	if err != nil || slices.Contains(roots, root) {
+		return err
+	}
+	return writeTrustedProjects(config, append(roots, root))
+}
+
+// UntrustProject stops the shell hook applying the options of the project
+// at root, returning false if it wasn't trusted.
+func UntrustProject(config *Config, root string) (bool, error) {
+	roots, err := TrustedProjects(config)
+	if err != nil {
+		return false, err
+	}
+	i := slices.Index(roots, root)
+	if i < 0 {
+		return false, nil
+	}
+	return true, writeTrustedProjects(config, slices.Delete(roots, i, i+1))
+}
+
+func writeTrustedProjects(config *Config, roots []string) error {
+	path := TrustedProjectsPath(config.Env)
+	if err := config.Fs.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	content := ""
+	for _, root := range roots {
+		content += root + "\n"
+	}
+	return afero.WriteFile(config.Fs, path, []byte(content), 0644)
+}
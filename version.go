@@ -0,0 +1,148 @@
+package chrb
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// CompareVersions compares two dotted version strings segment by segment,
+// numerically where both segments are numbers.
+func CompareVersions(a, b string) int {
+	as := splitVersion(a)
+	bs := splitVersion(b)
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		if i >= len(as) {
+			return -compareTail(bs[i])
+		}
+		if i >= len(bs) {
+			return compareTail(as[i])
+		}
+		an, aErr := strconv.Atoi(as[i])
+		bn, bErr := strconv.Atoi(bs[i])
+		switch {
+		case aErr == nil && bErr == nil:
+			if an != bn {
+				return compareInts(an, bn)
+			}
+		case aErr == nil:
+			// release segments sort after prerelease ones, so 3.4.0 > 3.4.0-preview1
+			return 1
+		case bErr == nil:
+			return -1
+		default:
+			if c := strings.Compare(as[i], bs[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	return 0
+}
+
+// compareTail compares a version against one that has the extra segment s,
+// e.g. 3.4.0.1 is newer than 3.4.0 but 3.4.0-preview1 is older.
+func compareTail(s string) int {
+	if _, err := strconv.Atoi(s); err != nil {
+		return -1
+	}
+	return 1
+}
+
+func splitVersion(v string) []string {
+	return strings.FieldsFunc(v, func(r rune) bool {
+		return r == '.' || r == '-'
+	})
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// VersionConstraint is a comma-separated list of requirements such as
+// ">= 3.1, < 3.4" or "~> 3.3". A bare version is a prefix match, the same
+// way FindRuby treats patterns.
+type VersionConstraint []versionRequirement
+
+type versionRequirement struct {
+	op      string
+	version string
+}
+
+var versionOps = []string{">=", "<=", "!=", "~>", "=", ">", "<"}
+
+func ParseVersionConstraint(s string) (VersionConstraint, error) {
+	constraint := VersionConstraint{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if len(part) == 0 {
+			continue
+		}
+		req := versionRequirement{op: "", version: part}
+		for _, op := range versionOps {
+			if strings.HasPrefix(part, op) {
+				req = versionRequirement{op: op, version: strings.TrimSpace(strings.TrimPrefix(part, op))}
+				break
+			}
+		}
+		if len(req.version) == 0 || len(splitVersion(req.version)) == 0 {
+			return nil, fmt.Errorf("invalid version constraint: %q", s)
+		}
+		constraint = append(constraint, req)
+	}
+	if len(constraint) == 0 {
+		return nil, fmt.Errorf("invalid version constraint: %q", s)
+	}
+	return constraint, nil
+}
+
+func (c VersionConstraint) Matches(version string) bool {
+	for _, req := range c {
+		if !req.matches(version) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r versionRequirement) matches(version string) bool {
+	cmp := CompareVersions(version, r.version)
+	switch r.op {
+	case "":
+		return version == r.version || strings.HasPrefix(version, strings.TrimSuffix(r.version, ".")+".")
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case "~>":
+		// ~> 3.3 allows >= 3.3 and < 4, ~> 3.3.1 allows >= 3.3.1 and < 3.4
+		segments := splitVersion(r.version)
+		if cmp < 0 {
+			return false
+		}
+		if len(segments) == 1 {
+			return true
+		}
+		upper := segments[:len(segments)-1]
+		n, err := strconv.Atoi(upper[len(upper)-1])
+		if err != nil {
+			return false
+		}
+		upper = append(append([]string{}, upper[:len(upper)-1]...), strconv.Itoa(n+1))
+		return CompareVersions(version, strings.Join(upper, ".")) < 0
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package chrb_test
+
+import (
+	"testing"
+
+	"github.com/segiddins/chrb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"3.3.6", "3.3.6", 0},
+		{"3.1.16", "3.1.2", 1},
+		{"3.1", "3.1.0", -1},
+		{"9.4.8.0", "9.4.10.0", -1},
+		{"3.4.0", "3.4.0-preview1", 1},
+		{"3.4.0-preview1", "3.4.0-preview2", -1},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.want, chrb.CompareVersions(test.a, test.b), "%s <=> %s", test.a, test.b)
+		assert.Equal(t, -test.want, chrb.CompareVersions(test.b, test.a), "%s <=> %s", test.b, test.a)
+	}
+}
+
+func TestVersionConstraint(t *testing.T) {
+	tests := []struct {
+		constraint string
+		matches    []string
+		rejects    []string
+	}{
+		{constraint: "3.3", matches: []string{"3.3", "3.3.0", "3.3.6"}, rejects: []string{"3.30.0", "3.2.9"}},
+		{constraint: ">= 3.3", matches: []string{"3.3.0", "3.4.1", "4.0.0"}, rejects: []string{"3.2.6", "3.2.9-preview1"}},
+		{constraint: ">= 3.1, < 3.4", matches: []string{"3.1.0", "3.3.6"}, rejects: []string{"3.0.7", "3.4.0"}},
+		{constraint: "~> 3.3", matches: []string{"3.3.0", "3.9.9"}, rejects: []string{"3.2.0", "4.0.0"}},
+		{constraint: "~> 3.3.1", matches: []string{"3.3.1", "3.3.6"}, rejects: []string{"3.3.0", "3.4.0"}},
+		{constraint: "!= 3.3.6", matches: []string{"3.3.5"}, rejects: []string{"3.3.6"}},
+		{constraint: "= 9.4.8.0", matches: []string{"9.4.8.0"}, rejects: []string{"9.4.8.1"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.constraint, func(t *testing.T) {
+			constraint, err := chrb.ParseVersionConstraint(test.constraint)
+			if !assert.NoError(t, err) {
+				return
+			}
+			for _, v := range test.matches {
+				assert.True(t, constraint.Matches(v), v)
+			}
+			for _, v := range test.rejects {
+				assert.False(t, constraint.Matches(v), v)
+			}
+		})
+	}
+
+	for _, invalid := range []string{"", ">=", ", "} {
+		_, err := chrb.ParseVersionConstraint(invalid)
+		assert.Error(t, err, invalid)
+	}
+}